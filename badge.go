@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const badgeMaxAge = 300
+const sparklineMaxAge = 600
+
+const sparklineDefaultWidth = 120
+const sparklineDefaultHeight = 30
+
+const badgeColorOk = "#4c1"
+const badgeColorError = "#e05d44"
+const badgeColorUnknown = "#9f9f9f"
+const badgeColorInfo = "#007ec6"
+
+// approximate text width in pixels of Verdana 11px, used for badge layout
+func badgeTextWidth(s string) int {
+	w := 0.0
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("iljI.,:;!|' ", r):
+			w += 3.5
+		case strings.ContainsRune("mwMW%", r):
+			w += 10
+		case r >= 'A' && r <= 'Z':
+			w += 7.5
+		default:
+			w += 6.5
+		}
+	}
+	return int(math.Ceil(w))
+}
+
+// renders a flat two part badge with <label> on grey and <value> on <color>
+func renderBadge(label, value, color string) string {
+	lw := badgeTextWidth(label) + 10
+	vw := badgeTextWidth(value) + 10
+	w := lw + vw
+
+	label = html.EscapeString(label)
+	value = html.EscapeString(value)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+
+		`<title>%s: %s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+
+		`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text></g></svg>`,
+		w, label, value, label, value, w, lw, lw, vw, color, w,
+		lw/2, label, lw/2, label, lw+vw/2, value, lw+vw/2, value)
+}
+
+// renders a polyline of <values> scaled to <width> x <height> pixels, <title> is shown as tooltip
+func renderSparkline(values []float64, width, height int, title string) string {
+	const pad = 2
+
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`,
+		width, height, width, height)
+	if title != "" {
+		svg += "<title>" + html.EscapeString(title) + "</title>"
+	}
+
+	if len(values) == 0 {
+		return svg + "</svg>"
+	}
+
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+	if hi-lo < 0.01 {
+		lo -= 0.5
+		hi += 0.5
+	}
+
+	x := func(i int) float64 {
+		if len(values) == 1 {
+			return float64(width) / 2
+		}
+		return pad + float64(i)*float64(width-2*pad)/float64(len(values)-1)
+	}
+	y := func(v float64) float64 {
+		return pad + (hi-v)*float64(height-2*pad)/(hi-lo)
+	}
+
+	points := make([]string, len(values))
+	for i, v := range values {
+		points[i] = fmt.Sprintf("%.1f,%.1f", x(i), y(v))
+	}
+
+	n := len(values) - 1
+	svg += fmt.Sprintf(`<polyline points="%s" fill="none" stroke="#1e5ac8" stroke-width="1.5" stroke-linejoin="round"/>`,
+		strings.Join(points, " "))
+	svg += fmt.Sprintf(`<circle cx="%.1f" cy="%.1f" r="2" fill="#1e5ac8"/></svg>`, x(n), y(values[n]))
+
+	return svg
+}
+
+// writes an SVG image with cache headers, answers conditional requests with 304 if the image is unchanged
+func writeSvg(resp http.ResponseWriter, req *http.Request, svg string, maxAge int) {
+	sum := sha1.Sum([]byte(svg))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	resp.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+	resp.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	resp.Header().Set("ETag", etag)
+
+	if req.Header.Get("If-None-Match") == etag {
+		resp.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	io.WriteString(resp, svg)
+}
+
+// GET /badge/staking.svg
+func handleBadgeStaking(resp http.ResponseWriter, req *http.Request) {
+	g_particldStatusMutex.Lock()
+	status := g_particldStatus.Status
+	g_particldStatusMutex.Unlock()
+
+	value, color := "unknown", badgeColorUnknown
+	switch {
+	case status == "Staking":
+		value, color = "active", badgeColorOk
+	case strings.HasPrefix(status, "Not Staking"):
+		value, color = "inactive", badgeColorError
+	case status != "":
+		value, color = "offline", badgeColorError
+	}
+
+	writeSvg(resp, req, renderBadge("staking", value, color), badgeMaxAge)
+}
+
+// GET /badge/rate.svg
+func handleBadgeRate(resp http.ResponseWriter, req *http.Request) {
+	g_particldStatusMutex.Lock()
+	rate := g_particldStatus.ActualRate
+	g_particldStatusMutex.Unlock()
+
+	value, color := "n/a", badgeColorUnknown
+	if rate > 0 {
+		value, color = strconv.FormatFloat(rate, 'f', 2, 64)+" %", badgeColorInfo
+	}
+
+	writeSvg(resp, req, renderBadge("staking rate", value, color), badgeMaxAge)
+}
+
+// GET /sparkline.svg?width=<pixels>&height=<pixels>, daily average staking rate of the last 30 days
+func handleSparkline(resp http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+
+	size := func(name string, def int) int {
+		if v, err := strconv.Atoi(q.Get(name)); err == nil && v >= 10 && v <= 1000 {
+			return v
+		}
+		return def
+	}
+	width := size("width", sparklineDefaultWidth)
+	height := size("height", sparklineDefaultHeight)
+
+	hist := stakingRateHistoryCopy(true)
+
+	values := make([]float64, 0, len(hist))
+	for i := len(hist) - 1; i >= 0; i-- {
+		values = append(values, hist[i].AvgRate)
+	}
+
+	title := ""
+	if len(values) > 0 {
+		title = "staking rate " + strconv.FormatFloat(values[len(values)-1], 'f', 2, 64) + " %"
+	}
+
+	writeSvg(resp, req, renderSparkline(values, width, height, title), sparklineMaxAge)
+}
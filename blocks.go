@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mua69/particlrpc"
+)
+
+type PoolBlock struct {
+	Height int64  `json:"height"`
+	Hash   string `json:"hash"`
+	Time   int64  `json:"time"`
+	Reward int64  `json:"reward"`
+}
+
+type PoolLuck struct {
+	Days     int     `json:"days"`
+	Found    int     `json:"found"`
+	Expected float64 `json:"expected"`
+	Luck     float64 `json:"luck"`
+	Reward   float64 `json:"reward"`
+}
+
+const BlocksPerDay = BlocksPerYear / 365
+
+// number of blocks scanned at startup if no pool block is recorded, and maximum number of blocks caught up
+const blockScanInitial = BlocksPerDay
+const blockScanMaxBackfill = 7 * BlocksPerDay
+
+const maxPoolBlocks = 1000
+
+var g_poolBlocks []PoolBlock
+var g_poolBlocksMutex sync.Mutex
+
+// signalled by block notifications to scan new blocks immediately
+var g_blockNotify = make(chan struct{}, 1)
+
+var g_luckPeriods = []int{1, 7, 30}
+
+func poolBlockRecord(b PoolBlock) {
+	g_poolBlocksMutex.Lock()
+	g_poolBlocks = append(g_poolBlocks, b)
+	if len(g_poolBlocks) > maxPoolBlocks {
+		g_poolBlocks = g_poolBlocks[len(g_poolBlocks)-maxPoolBlocks:]
+	}
+	g_poolBlocksMutex.Unlock()
+
+	if g_dbTables {
+		_, err := g_db.Exec("INSERT INTO poolblocks (block_nr, block_hash, block_time, reward) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+			b.Height, b.Hash, b.Time, b.Reward)
+		if err != nil {
+			fmt.Printf("poolBlockRecord: db insert failed: %v\n", err)
+		}
+	}
+}
+
+// most recent <n> pool blocks, newest first
+func poolBlocksRecent(n int) []PoolBlock {
+	var res []PoolBlock
+
+	if g_dbTables {
+		rows, err := g_db.Query("SELECT block_nr, block_hash, block_time, reward FROM poolblocks ORDER BY block_nr DESC LIMIT $1", n)
+		if err != nil {
+			fmt.Printf("poolBlocksRecent: db query failed: %v\n", err)
+			return nil
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var b PoolBlock
+			if err := rows.Scan(&b.Height, &b.Hash, &b.Time, &b.Reward); err != nil {
+				fmt.Printf("poolBlocksRecent: db scan failed: %v\n", err)
+				return nil
+			}
+			res = append(res, b)
+		}
+
+		if err := rows.Err(); err != nil {
+			fmt.Printf("poolBlocksRecent: db next row failed: %v\n", err)
+		}
+
+		return res
+	}
+
+	g_poolBlocksMutex.Lock()
+	defer g_poolBlocksMutex.Unlock()
+
+	for i := len(g_poolBlocks) - 1; i >= 0 && len(res) < n; i-- {
+		res = append(res, g_poolBlocks[i])
+	}
+
+	return res
+}
+
+// number of pool blocks and sum of their rewards since block time <from>
+func poolBlocksSince(from int64) (found int, reward int64) {
+	if g_dbTables {
+		err := g_db.QueryRow("SELECT count(*), coalesce(sum(reward), 0) FROM poolblocks WHERE block_time >= $1", from).
+			Scan(&found, &reward)
+		if err != nil {
+			fmt.Printf("poolBlocksSince: db query failed: %v\n", err)
+		}
+		return found, reward
+	}
+
+	g_poolBlocksMutex.Lock()
+	defer g_poolBlocksMutex.Unlock()
+
+	for _, b := range g_poolBlocks {
+		if b.Time >= from {
+			found++
+			reward += b.Reward
+		}
+	}
+
+	return found, reward
+}
+
+func poolBlocksLastHeight() int64 {
+	var h int64
+
+	if g_dbTables {
+		if err := g_db.QueryRow("SELECT coalesce(max(block_nr), 0) FROM poolblocks").Scan(&h); err != nil {
+			fmt.Printf("poolBlocksLastHeight: db query failed: %v\n", err)
+		}
+		return h
+	}
+
+	g_poolBlocksMutex.Lock()
+	defer g_poolBlocksMutex.Unlock()
+
+	if n := len(g_poolBlocks); n > 0 {
+		h = g_poolBlocks[n-1].Height
+	}
+
+	return h
+}
+
+// checks whether the block at <height> was staked by the staking wallet: the coinstake pays to the pool reward
+// address or is a transaction of the staking wallet
+func scanBlock(prpc *particlrpc.ParticlRpc, height int64) (PoolBlock, bool, error) {
+	var reward particlrpc.BlockReward
+
+	if err := prpc.CallRpc("getblockreward", "", []interface{}{height}, &reward); err != nil {
+		return PoolBlock{}, false, err
+	}
+
+	ours := false
+
+	if g_config.StakePoolRewardAdr != "" {
+		for _, o := range reward.Outputs {
+			if o.Script.Spendaddr == g_config.StakePoolRewardAdr {
+				ours = true
+				break
+			}
+		}
+	}
+
+	if !ours {
+		var tx map[string]interface{}
+		err := prpc.CallRpc("gettransaction", g_config.ParticldStakingWallet, []interface{}{reward.Coinstake}, &tx)
+		if err != nil {
+			if !strings.Contains(err.Error(), "non-wallet transaction") {
+				return PoolBlock{}, false, err
+			}
+		} else {
+			ours = true
+		}
+	}
+
+	if !ours {
+		return PoolBlock{}, false, nil
+	}
+
+	var header particlrpc.Block
+	if err := prpc.CallRpc("getblockheader", "", []interface{}{reward.Blockhash}, &header); err != nil {
+		return PoolBlock{}, false, err
+	}
+
+	return PoolBlock{height, reward.Blockhash, header.Time, int64(math.Round(reward.Stakereward * SatPerPart))}, true, nil
+}
+
+// scans new blocks for blocks staked by the staking wallet, triggered by block notifications or once per minute
+func blockScanner() {
+	prpc := particlrpc.NewParticlRpc()
+	prpc.SetRpcPort(g_config.ParticldRpcPort)
+	prpc.SetDataDirectoy(g_config.ParticldDataDir)
+
+	var next int64
+	caughtUp := false
+
+	for {
+		if err := prpc.ReadPartRpcCookie(); err != nil {
+			fmt.Printf("blockScanner: %v\n", err)
+		} else if bcinfo, err := prpc.GetBlockchainInfo(); err != nil {
+			fmt.Printf("blockScanner: %v\n", err)
+		} else {
+			tip := int64(bcinfo.Blocks)
+
+			if next == 0 {
+				next = tip - blockScanInitial + 1
+				if last := poolBlocksLastHeight(); last > 0 {
+					next = last + 1
+				}
+			}
+			if next < tip-blockScanMaxBackfill+1 {
+				next = tip - blockScanMaxBackfill + 1
+			}
+
+			for ; next <= tip; next++ {
+				b, ours, err := scanBlock(prpc, next)
+				if err != nil {
+					fmt.Printf("blockScanner: block %d: %v\n", next, err)
+					break
+				}
+				if ours {
+					fmt.Printf("blockScanner: pool staked block %d, reward %.8f PART\n", b.Height,
+						float64(b.Reward)/SatPerPart)
+					poolBlockRecord(b)
+				}
+
+				// blocks caught up at startup are not published
+				if caughtUp {
+					ev := map[string]interface{}{"height": next, "pool": ours}
+					if ours {
+						ev["hash"] = b.Hash
+						ev["reward"] = b.Reward
+					}
+					eventsPublish("block", ev)
+				}
+			}
+			if next > tip {
+				caughtUp = true
+			}
+		}
+
+		select {
+		case <-g_blockNotify:
+		case <-time.After(60 * time.Second):
+		}
+	}
+}
+
+// expected versus found pool blocks of the last days, expectation is based on the current staking weight of
+// the pool and the network
+func poolLuck() []PoolLuck {
+	g_particldStatusMutex.Lock()
+	weight := g_particldStatus.WeightSat
+	netWeight := g_particldStatus.NetWeightSat
+	g_particldStatusMutex.Unlock()
+
+	var res []PoolLuck
+
+	for _, days := range g_luckPeriods {
+		l := PoolLuck{Days: days}
+
+		var reward int64
+		l.Found, reward = poolBlocksSince(time.Now().Unix() - int64(days)*SecondsPerDay)
+		l.Reward = float64(reward) / SatPerPart
+
+		if netWeight > 0 {
+			l.Expected = float64(weight) / float64(netWeight) * float64(days*BlocksPerDay)
+		}
+		if l.Expected > 0 {
+			l.Luck = float64(l.Found) / l.Expected * 100
+		}
+
+		res = append(res, l)
+	}
+
+	return res
+}
+
+func handleBlockNotify(resp http.ResponseWriter, req *http.Request) {
+	select {
+	case g_blockNotify <- struct{}{}:
+	default:
+	}
+
+	io.WriteString(resp, "\"ok\"")
+}
+
+func handlePoolBlocks(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	res := struct {
+		Blocks []PoolBlock `json:"blocks"`
+		Luck   []PoolLuck  `json:"luck"`
+	}{poolBlocksRecent(20), poolLuck()}
+
+	if res.Blocks == nil {
+		res.Blocks = []PoolBlock{}
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		fmt.Printf("handlePoolBlocks: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
+
+func telegramCmdBlocks(chatId int64) {
+	lang := telegramChatLanguage(chatId)
+
+	table := fmt.Sprintf("%-5s %5s %7s %6s\n", tr(lang, "col_days"), tr(lang, "col_found"),
+		tr(lang, "col_expected"), tr(lang, "col_luck"))
+	for _, l := range poolLuck() {
+		table += fmt.Sprintf("%-5d %5d %7s %6s\n", l.Days, l.Found, formatNumber(lang, l.Expected, 1),
+			formatNumber(lang, l.Luck, 0)+"%")
+	}
+
+	msg := newTgMsg().Bold(tr(lang, "pool_luck")).Text("\n").Pre(table)
+
+	blocks := poolBlocksRecent(5)
+	if len(blocks) == 0 {
+		msg.Text(tr(lang, "no_pool_blocks"))
+	} else {
+		txt := ""
+		for _, b := range blocks {
+			txt += fmt.Sprintf("%d %s %s\n", b.Height, time.Unix(b.Time, 0).UTC().Format("01-02 15:04"),
+				formatPart(lang, float64(b.Reward)/SatPerPart, 4))
+		}
+		msg.Bold(tr(lang, "pool_blocks")).Text("\n").Pre(txt)
+	}
+
+	telegramSendFormatted(chatId, msg)
+}
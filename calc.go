@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const calcDefaultDays = 365
+const calcMaxDays = 10 * 365
+
+// upper limit of the staked amount, exceeds the total PART money supply
+const calcMaxAmount = 100e6
+
+type RewardScenario struct {
+	Name           string  `json:"name"`
+	Rate           float64 `json:"rate"`
+	Reward         float64 `json:"reward"`
+	RewardCompound float64 `json:"reward_compound"`
+}
+
+type RewardProjection struct {
+	Amount      float64          `json:"amount"`
+	Days        int              `json:"days"`
+	PoolFee     float64          `json:"pool_fee"`
+	HistoryDays int              `json:"history_days"`
+	Scenarios   []RewardScenario `json:"scenarios"`
+}
+
+// rewards of staking <amount> for <days> at annual <rate> percent after deduction of pool <fee> percent,
+// compounding adds the rewards to the staked amount daily
+func projectReward(amount float64, days int, rate, fee float64) (reward, compound float64) {
+	r := rate / 100 * (1 - fee/100)
+
+	reward = amount * r * float64(days) / 365
+	compound = amount * (math.Pow(1+r/365, float64(days)) - 1)
+
+	return reward, compound
+}
+
+// projects rewards for the current nominal and actual staking rate and for the range of the daily actual
+// staking rate history
+func calcRewards(amount float64, days int, fee float64) RewardProjection {
+	g_particldStatusMutex.Lock()
+	status := g_particldStatus
+	g_particldStatusMutex.Unlock()
+
+	hist := stakingRateHistoryCopy(true)
+
+	p := RewardProjection{Amount: amount, Days: days, PoolFee: fee, HistoryDays: len(hist)}
+
+	add := func(name string, rate float64) {
+		reward, compound := projectReward(amount, days, rate, fee)
+		p.Scenarios = append(p.Scenarios, RewardScenario{name, rate, reward, compound})
+	}
+
+	add("nominal", status.NominalRate)
+	add("actual", status.ActualRate)
+
+	if len(hist) > 0 {
+		avg := 0.0
+		minRate := math.Inf(1)
+		maxRate := math.Inf(-1)
+		for _, h := range hist {
+			avg += h.AvgRate
+			minRate = math.Min(minRate, h.AvgRate)
+			maxRate = math.Max(maxRate, h.AvgRate)
+		}
+		avg /= float64(len(hist))
+
+		add("history_min", minRate)
+		add("history_avg", avg)
+		add("history_max", maxRate)
+	}
+
+	return p
+}
+
+// true if all projected rewards are finite numbers
+func (p *RewardProjection) finite() bool {
+	for _, s := range p.Scenarios {
+		for _, v := range []float64{s.Rate, s.Reward, s.RewardCompound} {
+			if math.IsInf(v, 0) || math.IsNaN(v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checks calculator arguments, returns message catalog key of the error or empty string
+func calcCheckArgs(amount float64, days int, fee float64) string {
+	if amount <= 0 || amount > calcMaxAmount || math.IsNaN(amount) {
+		return "invalid_amount"
+	}
+	if days < 1 || days > calcMaxDays {
+		return "calc_invalid_days"
+	}
+	if fee < 0 || fee >= 100 || math.IsNaN(fee) {
+		return "calc_invalid_fee"
+	}
+	return ""
+}
+
+func telegramCmdCalc(chatId int64, args []string) {
+	lang := telegramChatLanguage(chatId)
+
+	if len(args) < 1 {
+		telegramSendMessage(chatId, tr(lang, "calc_usage"))
+		return
+	}
+
+	amount, err := parseAmount(lang, args[0])
+	if err != nil || calcCheckArgs(amount, 1, 0) != "" {
+		telegramSendMessage(chatId, tr(lang, "invalid_amount", args[0]))
+		return
+	}
+
+	days := calcDefaultDays
+	if len(args) >= 2 {
+		days, err = strconv.Atoi(args[1])
+		if err != nil || calcCheckArgs(amount, days, 0) != "" {
+			telegramSendMessage(chatId, tr(lang, "calc_invalid_days", args[1], calcMaxDays))
+			return
+		}
+	}
+
+	var fee float64
+	if len(args) >= 3 {
+		fee, err = parseAmount(lang, strings.TrimSuffix(args[2], "%"))
+		if err != nil || calcCheckArgs(amount, days, fee) != "" {
+			telegramSendMessage(chatId, tr(lang, "calc_invalid_fee", args[2]))
+			return
+		}
+	}
+
+	p := calcRewards(amount, days, fee)
+	if !p.finite() {
+		telegramSendMessage(chatId, tr(lang, "invalid_amount", args[0]))
+		return
+	}
+
+	telegramSendFormatted(chatId, telegramCalcMsg(lang, p))
+}
+
+func telegramCalcMsg(lang string, p RewardProjection) *tgMsg {
+	rows := [][4]string{{"", tr(lang, "col_rate"), tr(lang, "col_reward"), tr(lang, "col_compound")}}
+
+	for _, s := range p.Scenarios {
+		rows = append(rows, [4]string{tr(lang, "calc_"+s.Name), formatNumber(lang, s.Rate, 2),
+			formatNumber(lang, s.Reward, 2), formatNumber(lang, s.RewardCompound, 2)})
+	}
+
+	var width [4]int
+	for _, r := range rows {
+		for i, c := range r {
+			if n := utf8.RuneCountInString(c); n > width[i] {
+				width[i] = n
+			}
+		}
+	}
+
+	table := ""
+	for _, r := range rows {
+		table += r[0] + strings.Repeat(" ", width[0]-utf8.RuneCountInString(r[0]))
+		for i := 1; i < len(r); i++ {
+			table += " " + strings.Repeat(" ", width[i]-utf8.RuneCountInString(r[i])) + r[i]
+		}
+		table += "\n"
+	}
+
+	msg := newTgMsg().Bold(tr(lang, "calc_title", formatPart(lang, p.Amount, 2), p.Days)).Text("\n")
+	msg.Text(tr(lang, "calc_fee", formatNumber(lang, p.PoolFee, 2)) + "\n")
+	msg.Pre(table)
+
+	if p.HistoryDays > 0 {
+		msg.Text(tr(lang, "calc_history", p.HistoryDays))
+	} else {
+		msg.Text(tr(lang, "no_history"))
+	}
+
+	return msg
+}
+
+func handleCalc(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	q := req.URL.Query()
+
+	amount, err := strconv.ParseFloat(q.Get("amount"), 64)
+	if err != nil {
+		amount = 0
+	}
+
+	days := calcDefaultDays
+	if v := q.Get("days"); v != "" {
+		if days, err = strconv.Atoi(v); err != nil {
+			days = 0
+		}
+	}
+
+	var fee float64
+	if v := q.Get("fee"); v != "" {
+		if fee, err = strconv.ParseFloat(v, 64); err != nil {
+			fee = -1
+		}
+	}
+
+	if key := calcCheckArgs(amount, days, fee); key != "" {
+		writeJsonError(resp, http.StatusBadRequest, strings.TrimPrefix(key, "calc_"))
+		return
+	}
+
+	p := calcRewards(amount, days, fee)
+	if !p.finite() {
+		writeJsonError(resp, http.StatusBadRequest, "invalid_amount")
+		return
+	}
+
+	d, err := json.Marshal(p)
+	if err != nil {
+		fmt.Printf("handleCalc: marshal: %v\n", err)
+		writeJsonError(resp, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	io.WriteString(resp, string(d))
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"time"
+)
+
+type chartSeries struct {
+	Values []float64
+	Color  color.RGBA
+	Width  int
+}
+
+const chartWidth = 800
+const chartHeight = 400
+const chartMarginLeft = 70
+const chartMarginRight = 20
+const chartMarginTop = 20
+const chartMarginBottom = 40
+
+const chartFontScale = 2
+
+var chartColorBackground = color.RGBA{255, 255, 255, 255}
+var chartColorAxis = color.RGBA{60, 60, 60, 255}
+var chartColorGrid = color.RGBA{220, 220, 220, 255}
+var chartColorAvg = color.RGBA{30, 90, 200, 255}
+var chartColorMinMax = color.RGBA{160, 160, 160, 255}
+
+// 5x7 bitmap font, covers the characters needed for axis labels only
+var chartFont = map[rune][7]uint8{
+	'0': {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1': {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2': {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3': {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4': {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5': {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6': {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7': {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8': {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9': {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	',': {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	'-': {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	':': {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'%': {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'/': {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'K': {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'M': {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	' ': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+}
+
+func chartTextWidth(s string) int {
+	return len([]rune(s)) * 6 * chartFontScale
+}
+
+func chartDrawText(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		glyph, ok := chartFont[r]
+		if ok {
+			for row := 0; row < 7; row++ {
+				for col := 0; col < 5; col++ {
+					if glyph[row]&(0x10>>uint(col)) != 0 {
+						chartFillRect(img, x+col*chartFontScale, y+row*chartFontScale, chartFontScale, chartFontScale, c)
+					}
+				}
+			}
+		}
+		x += 6 * chartFontScale
+	}
+}
+
+func chartFillRect(img *image.RGBA, x, y, w, h int, c color.RGBA) {
+	for i := x; i < x+w; i++ {
+		for j := y; j < y+h; j++ {
+			img.SetRGBA(i, j, c)
+		}
+	}
+}
+
+// draws a line of given width using Bresenham's algorithm
+func chartDrawLine(img *image.RGBA, x0, y0, x1, y1, width int, c color.RGBA) {
+	dx := x1 - x0
+	if dx < 0 {
+		dx = -dx
+	}
+	dy := y1 - y0
+	if dy < 0 {
+		dy = -dy
+	}
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx - dy
+	off := width / 2
+
+	for {
+		chartFillRect(img, x0-off, y0-off, width, width, c)
+
+		if x0 == x1 && y0 == y1 {
+			break
+		}
+		e2 := 2 * e
+		if e2 > -dy {
+			e -= dy
+			x0 += sx
+		}
+		if e2 < dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// renderLineChart renders the given series as PNG line chart. All series must have the same number of values
+// as there are x axis labels. NaN values are treated as gaps.
+func renderLineChart(xLabels []string, series []chartSeries, yFormat string) ([]byte, error) {
+	n := len(xLabels)
+	if n == 0 || len(series) == 0 {
+		return nil, errors.New("no data")
+	}
+
+	minV := math.Inf(1)
+	maxV := math.Inf(-1)
+
+	for _, s := range series {
+		if len(s.Values) != n {
+			return nil, fmt.Errorf("series length mismatch: %d != %d", len(s.Values), n)
+		}
+		for _, v := range s.Values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			minV = math.Min(minV, v)
+			maxV = math.Max(maxV, v)
+		}
+	}
+
+	if math.IsInf(minV, 0) {
+		return nil, errors.New("no valid data points")
+	}
+
+	if maxV-minV < 1e-9 {
+		minV -= 0.5
+		maxV += 0.5
+	} else {
+		pad := (maxV - minV) * 0.05
+		minV -= pad
+		maxV += pad
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	chartFillRect(img, 0, 0, chartWidth, chartHeight, chartColorBackground)
+
+	plotW := chartWidth - chartMarginLeft - chartMarginRight
+	plotH := chartHeight - chartMarginTop - chartMarginBottom
+	x0 := chartMarginLeft
+	y0 := chartMarginTop + plotH
+
+	toX := func(i int) int {
+		if n == 1 {
+			return x0 + plotW/2
+		}
+		return x0 + i*plotW/(n-1)
+	}
+	toY := func(v float64) int {
+		return y0 - int(math.Round((v-minV)/(maxV-minV)*float64(plotH)))
+	}
+
+	// horizontal grid and y axis labels
+	ticks := 5
+	for i := 0; i <= ticks; i++ {
+		v := minV + (maxV-minV)*float64(i)/float64(ticks)
+		y := toY(v)
+		chartDrawLine(img, x0, y, x0+plotW, y, 1, chartColorGrid)
+		label := fmt.Sprintf(yFormat, v)
+		chartDrawText(img, x0-chartTextWidth(label)-6, y-7*chartFontScale/2, label, chartColorAxis)
+	}
+
+	// x axis labels, skip labels to avoid overlapping
+	maxLabelW := 0
+	for _, l := range xLabels {
+		if w := chartTextWidth(l); w > maxLabelW {
+			maxLabelW = w
+		}
+	}
+	step := 1
+	if n > 1 {
+		spacing := float64(plotW) / float64(n-1)
+		step = int(math.Ceil(float64(maxLabelW+8) / spacing))
+		if step < 1 {
+			step = 1
+		}
+	}
+	for i := 0; i < n; i += step {
+		x := toX(i)
+		chartDrawLine(img, x, y0, x, y0+4, 1, chartColorAxis)
+		chartDrawText(img, x-chartTextWidth(xLabels[i])/2, y0+10, xLabels[i], chartColorAxis)
+	}
+
+	chartDrawLine(img, x0, chartMarginTop, x0, y0, 1, chartColorAxis)
+	chartDrawLine(img, x0, y0, x0+plotW, y0, 1, chartColorAxis)
+
+	for _, s := range series {
+		width := s.Width
+		if width < 1 {
+			width = 1
+		}
+		prev := -1
+		for i, v := range s.Values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				prev = -1
+				continue
+			}
+			if prev >= 0 {
+				chartDrawLine(img, toX(prev), toY(s.Values[prev]), toX(i), toY(v), width, s.Color)
+			} else {
+				chartFillRect(img, toX(i)-width/2, toY(v)-width/2, width, width, s.Color)
+			}
+			prev = i
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderStakingRateChart renders the avg rate and the 10th and 90th percentile of the given history as PNG chart,
+// the percentiles are shown instead of min and max rate, which are dominated by single block outliers.
+// History is expected in descending time order as returned by getStakingRateHistory.
+func renderStakingRateChart(hist []StakingRateHistory, daily bool) ([]byte, error) {
+	n := len(hist)
+	labels := make([]string, n)
+	avg := chartSeries{make([]float64, n), chartColorAvg, 3}
+	p10 := chartSeries{make([]float64, n), chartColorMinMax, 1}
+	p90 := chartSeries{make([]float64, n), chartColorMinMax, 1}
+
+	for i := 0; i < n; i++ {
+		h := hist[n-1-i]
+		t := time.Unix(h.Timestamp, 0).UTC()
+		if daily {
+			labels[i] = t.Format("01-02")
+		} else {
+			labels[i] = t.Format("15")
+		}
+		avg.Values[i] = h.AvgRate
+		p10.Values[i] = h.P10
+		p90.Values[i] = h.P90
+	}
+
+	return renderLineChart(labels, []chartSeries{p10, p90, avg}, "%.1f")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// read-only status dashboard, served at / and using the JSON endpoints only
+//
+//go:embed dashboard
+var g_dashboardFiles embed.FS
+
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(g_dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.FileServer(http.FS(files))
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set("Content-Security-Policy", "default-src 'self'; img-src 'self' data:")
+		resp.Header().Set("X-Content-Type-Options", "nosniff")
+		resp.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(resp, req)
+	})
+}
@@ -0,0 +1,274 @@
+"use strict";
+
+(function () {
+  const SVG_NS = "http://www.w3.org/2000/svg";
+
+  function $(id) {
+    return document.getElementById(id);
+  }
+
+  function fmt(v, decimals) {
+    if (typeof v !== "number" || !isFinite(v)) {
+      return "-";
+    }
+    return v.toLocaleString(undefined, { minimumFractionDigits: decimals, maximumFractionDigits: decimals });
+  }
+
+  function fmtTime(t) {
+    return t ? new Date(t * 1000).toLocaleString() : "-";
+  }
+
+  async function getJson(url) {
+    const resp = await fetch(url, { cache: "no-store" });
+    const data = await resp.json();
+    if (!resp.ok) {
+      throw new Error(data && data.error ? data.error : resp.statusText);
+    }
+    return data;
+  }
+
+  // fills a two column table with label / value rows, values are inserted as text only
+  function fillTable(table, rows) {
+    table.replaceChildren();
+    for (const [label, value, cls] of rows) {
+      const tr = table.insertRow();
+      tr.insertCell().textContent = label;
+      const td = tr.insertCell();
+      td.textContent = value;
+      if (cls) {
+        td.className = cls;
+      }
+    }
+  }
+
+  function showStatus(s) {
+    fillTable($("status"), [
+      ["Status", s.status || "-", s.status === "Staking" ? "ok" : "error"],
+      ["Version", s.version],
+      ["Uptime", s.uptime],
+      ["Peers", s.peers],
+      ["Last block", s.last_block],
+      ["Staking weight", s.weight],
+      ["Network weight", s.net_weight],
+      ["Nominal rate", fmt(s.nominal_rate, 2) + " %"],
+      ["Actual rate", fmt(s.actual_rate, 2) + " %"],
+      ["Actual rate 7 / 30 days", fmt(s.actual_rate_7d, 2) + " / " + fmt(s.actual_rate_30d, 2) + " %"],
+      ["Rate estimation", (s.rate_method || "-") + ", " + fmt(s.rate_window / 60, 0) + " min"],
+    ]);
+  }
+
+  function showPool(p) {
+    if (!p.updated) {
+      fillTable($("pool"), [["Status", "no data"]]);
+      return;
+    }
+    fillTable($("pool"), [
+      ["Server", p.ok ? "reachable" : "not reachable", p.ok ? "ok" : "error"],
+      ["Updated", fmtTime(p.updated)],
+      ["Pool height", String(p.height)],
+      ["Staking weight", fmt(p.stake_weight, 0) + " PART"],
+      ["Balance", fmt(p.balance, 2) + " PART"],
+      ["Accounts", String(p.accounts)],
+      ["Blocks found", String(p.blocks_found)],
+      ["Last block found", String(p.last_block_found)],
+      ["Pending payouts", p.pending_payouts + " (" + fmt(p.pending_amount, 2) + " PART)"],
+    ]);
+  }
+
+  function svgEl(name, attrs) {
+    const el = document.createElementNS(SVG_NS, name);
+    for (const k in attrs) {
+      el.setAttribute(k, attrs[k]);
+    }
+    return el;
+  }
+
+  // draws points [unix time, avg, min, max] as line chart with min/max band
+  function drawChart(container, points, daily) {
+    container.replaceChildren();
+    if (!points || points.length === 0) {
+      container.textContent = "No staking rate history available.";
+      return;
+    }
+
+    const w = 800, h = 200, ml = 40, mr = 10, mt = 10, mb = 20;
+    const svg = svgEl("svg", { viewBox: "0 0 " + w + " " + h, preserveAspectRatio: "none" });
+
+    let lo = Infinity, hi = -Infinity;
+    for (const p of points) {
+      lo = Math.min(lo, p[2], p[1]);
+      hi = Math.max(hi, p[3], p[1]);
+    }
+    if (hi - lo < 0.1) {
+      hi += 0.05;
+      lo -= 0.05;
+    }
+
+    const n = points.length;
+    const x = (i) => ml + (n > 1 ? (i * (w - ml - mr)) / (n - 1) : (w - ml - mr) / 2);
+    const y = (v) => mt + ((hi - v) * (h - mt - mb)) / (hi - lo);
+
+    for (let i = 0; i <= 4; i++) {
+      const v = lo + ((hi - lo) * i) / 4;
+      svg.appendChild(svgEl("line", { x1: ml, x2: w - mr, y1: y(v), y2: y(v), class: "grid" }));
+      const label = svgEl("text", { x: ml - 4, y: y(v) + 3, "text-anchor": "end", class: "axis" });
+      label.textContent = v.toFixed(1);
+      svg.appendChild(label);
+    }
+
+    const step = Math.max(1, Math.ceil(n / 8));
+    for (let i = 0; i < n; i += step) {
+      const d = new Date(points[i][0] * 1000);
+      const label = svgEl("text", { x: x(i), y: h - 5, "text-anchor": "middle", class: "axis" });
+      label.textContent = daily
+        ? String(d.getUTCMonth() + 1).padStart(2, "0") + "-" + String(d.getUTCDate()).padStart(2, "0")
+        : String(d.getUTCHours()).padStart(2, "0") + ":00";
+      svg.appendChild(label);
+    }
+
+    let band = "";
+    points.forEach((p, i) => (band += (i ? "L" : "M") + x(i) + "," + y(p[3])));
+    for (let i = n - 1; i >= 0; i--) {
+      band += "L" + x(i) + "," + y(points[i][2]);
+    }
+    svg.appendChild(svgEl("path", { d: band + "Z", class: "range" }));
+
+    let line = "";
+    points.forEach((p, i) => (line += (i ? "L" : "M") + x(i) + "," + y(p[1])));
+    svg.appendChild(svgEl("path", { d: line, class: "avg" }));
+
+    container.appendChild(svg);
+  }
+
+  function addEvent(ev, prepend) {
+    const li = document.createElement("li");
+    const time = document.createElement("time");
+    time.textContent = fmtTime(ev.time);
+    const msg = document.createElement("span");
+    msg.className = ev.ok ? "ok" : "error";
+    msg.textContent = (ev.source === "pool" ? "Stake pool: " : "") + ev.message;
+    li.append(time, msg);
+
+    const list = $("events");
+    if (list.firstChild && list.firstChild.dataset.empty) {
+      list.replaceChildren();
+    }
+    if (prepend) {
+      list.prepend(li);
+    } else {
+      list.append(li);
+    }
+  }
+
+  async function loadStatus() {
+    try {
+      showStatus(await getJson("stat"));
+    } catch (e) {
+      fillTable($("status"), [["Error", e.message, "error"]]);
+    }
+  }
+
+  async function loadPool() {
+    try {
+      showPool(await getJson("pool"));
+    } catch (e) {
+      fillTable($("pool"), [["Error", e.message, "error"]]);
+    }
+  }
+
+  async function loadRates() {
+    try {
+      const hist = await getJson("stakingrate");
+      drawChart($("chart-hourly"), hist.hourly, false);
+      drawChart($("chart-daily"), hist.daily, true);
+    } catch (e) {
+      $("chart-hourly").textContent = e.message;
+    }
+  }
+
+  async function loadEvents() {
+    const list = $("events");
+    try {
+      const events = await getJson("watchdog/events");
+      list.replaceChildren();
+      if (events.length === 0) {
+        const li = document.createElement("li");
+        li.dataset.empty = "1";
+        li.textContent = "No watchdog events in the last 7 days.";
+        list.append(li);
+      }
+      for (const ev of events) {
+        addEvent(ev, false);
+      }
+    } catch (e) {
+      list.textContent = e.message;
+    }
+  }
+
+  async function lookupAccount(ev) {
+    ev.preventDefault();
+    const id = $("account-id").value.trim();
+    if (!id) {
+      return;
+    }
+    const table = $("account");
+    fillTable(table, [["Account", "loading..."]]);
+    try {
+      const a = await getJson("account/" + encodeURIComponent(id));
+      const sat = 1e8;
+      fillTable(table, [
+        ["Account", id],
+        ["Total rewards", fmt(a.accumulated / sat / sat, 8) + " PART"],
+        ["Confirmed payout", fmt(a.rewardpaidout / sat, 8) + " PART"],
+        ["Unconfirmed payout", fmt(a.rewardpending / sat, 8) + " PART"],
+        ["Open payout", fmt((a.accumulated / sat - a.rewardpaidout - a.rewardpending) / sat, 8) + " PART"],
+        ["Last staking weight", fmt(a.currenttotal / sat, 8) + " PART"],
+      ]);
+    } catch (e) {
+      const messages = {
+        invalid_account: "Account ID is not valid.",
+        unknown_account: "Account ID is not known to the staking pool.",
+        pool_down: "Staking pool server is not available.",
+        pool_timeout: "Staking pool server did not respond in time.",
+        no_pool: "No staking pool server configured.",
+      };
+      fillTable(table, [["Error", messages[e.message] || e.message, "error"]]);
+    }
+  }
+
+  function connectEvents() {
+    if (!window.EventSource) {
+      setInterval(loadStatus, 30000);
+      return;
+    }
+
+    const live = $("live");
+    const es = new EventSource("events");
+
+    es.onopen = () => {
+      live.textContent = "live";
+      live.className = "live on";
+    };
+    es.onerror = () => {
+      live.textContent = "offline";
+      live.className = "live off";
+    };
+    es.addEventListener("status", (e) => showStatus(JSON.parse(e.data)));
+    es.addEventListener("watchdog", (e) => {
+      const ev = JSON.parse(e.data);
+      ev.time = Math.floor(Date.now() / 1000);
+      addEvent(ev, true);
+    });
+  }
+
+  $("account-form").addEventListener("submit", lookupAccount);
+
+  loadStatus();
+  loadPool();
+  loadRates();
+  loadEvents();
+  connectEvents();
+
+  setInterval(loadRates, 10 * 60 * 1000);
+  setInterval(loadPool, 5 * 60 * 1000);
+})();
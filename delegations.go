@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mua69/particlrpc"
+)
+
+type Delegation struct {
+	Address string  `json:"address"`
+	Value   float64 `json:"value"`
+	Utxos   int     `json:"utxos"`
+}
+
+type DelegationStats struct {
+	Updated     int64        `json:"updated"`
+	Utxos       int          `json:"utxos"`
+	Delegators  int          `json:"delegators"`
+	TotalWeight float64      `json:"total_weight"`
+	Largest     []Delegation `json:"largest"`
+}
+
+const delegationCheckInterval = 10 * 60
+const delegationDefaultAlertThreshold = 1000
+const delegationLargestCount = 10
+
+var g_delegationStats DelegationStats
+var g_delegationMutex sync.Mutex
+
+// delegated value per spend address of the cold staking outputs staked by the pool
+func delegationsRetrieve(prpc *particlrpc.ParticlRpc) (map[string]*Delegation, int, error) {
+	var unspent []particlrpc.ColdStakeUnspent
+
+	err := prpc.CallRpc("listcoldstakeunspent", g_config.ParticldStakingWallet,
+		[]interface{}{g_config.ColdStakingAddress}, &unspent)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := make(map[string]*Delegation)
+	for _, u := range unspent {
+		d, ok := res[u.Addrspend]
+		if !ok {
+			d = &Delegation{Address: u.Addrspend}
+			res[u.Addrspend] = d
+		}
+		d.Value += float64(u.Value) / SatPerPart
+		d.Utxos++
+	}
+
+	return res, len(unspent), nil
+}
+
+func delegationStatsFrom(delegations map[string]*Delegation, utxos int) DelegationStats {
+	stats := DelegationStats{Updated: time.Now().Unix(), Utxos: utxos, Delegators: len(delegations)}
+
+	for _, d := range delegations {
+		stats.TotalWeight += d.Value
+		stats.Largest = append(stats.Largest, *d)
+	}
+
+	sort.Slice(stats.Largest, func(i, j int) bool { return stats.Largest[i].Value > stats.Largest[j].Value })
+	if len(stats.Largest) > delegationLargestCount {
+		stats.Largest = stats.Largest[:delegationLargestCount]
+	}
+
+	return stats
+}
+
+// delegator with the largest absolute change of the delegated value
+func delegationLargestChange(prev, cur map[string]*Delegation) (address string, change float64) {
+	for a, d := range cur {
+		c := d.Value
+		if p, ok := prev[a]; ok {
+			c -= p.Value
+		}
+		if math.Abs(c) > math.Abs(change) {
+			address, change = a, c
+		}
+	}
+
+	for a, p := range prev {
+		if _, ok := cur[a]; !ok && p.Value > math.Abs(change) {
+			address, change = a, -p.Value
+		}
+	}
+
+	return address, change
+}
+
+func delegationStatsCopy() DelegationStats {
+	g_delegationMutex.Lock()
+	defer g_delegationMutex.Unlock()
+	return g_delegationStats
+}
+
+// periodically retrieves the cold staking delegations, the largest change of a delegation since the previous
+// check is reported if it exceeds the alert threshold
+func delegationCollector() {
+	threshold := g_config.DelegationAlertThreshold
+	if threshold <= 0 {
+		threshold = delegationDefaultAlertThreshold
+	}
+
+	lang := watchdogLanguage()
+
+	prpc := particlrpc.NewParticlRpc()
+	prpc.SetRpcPort(g_config.ParticldRpcPort)
+	prpc.SetDataDirectoy(g_config.ParticldDataDir)
+
+	var prev map[string]*Delegation
+
+	for {
+		err := prpc.ReadPartRpcCookie()
+		if err == nil {
+			var cur map[string]*Delegation
+			var utxos int
+
+			cur, utxos, err = delegationsRetrieve(prpc)
+			if err == nil {
+				stats := delegationStatsFrom(cur, utxos)
+
+				g_delegationMutex.Lock()
+				g_delegationStats = stats
+				g_delegationMutex.Unlock()
+
+				if prev != nil {
+					address, change := delegationLargestChange(prev, cur)
+					if math.Abs(change) >= float64(threshold) {
+						sign := "+"
+						if change < 0 {
+							sign = "-"
+						}
+						msg := tr(lang, "delegation_change", address, sign+formatPart(lang, math.Abs(change), 0),
+							formatPart(lang, stats.TotalWeight, 0))
+						fmt.Printf("Delegations: %s\n", msg)
+						watchdogInfo(msg + "\n")
+					}
+				}
+				prev = cur
+			}
+		}
+
+		if err != nil {
+			fmt.Printf("delegationCollector: %v\n", err)
+		}
+
+		time.Sleep(delegationCheckInterval * time.Second)
+	}
+}
+
+func handleDelegations(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	stats := delegationStatsCopy()
+	if stats.Largest == nil {
+		stats.Largest = []Delegation{}
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		fmt.Printf("handleDelegations: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
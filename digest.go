@@ -0,0 +1,271 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type Digest struct {
+	Period string
+	From   time.Time
+	To     time.Time
+
+	RatesOk bool
+	AvgRate float64
+	MinRate float64
+	MaxRate float64
+	Blocks  int
+
+	WeightOk    bool
+	WeightStart int64
+	WeightEnd   int64
+
+	UptimeOk bool
+	Uptime   float64
+	Alerts   int
+}
+
+// digest periods and their cron schedule for email digests
+var g_digestPeriods = map[string]string{
+	"weekly":  "@weekly",
+	"monthly": "@monthly",
+}
+
+func digestPeriodStart(period string, to time.Time) time.Time {
+	if period == "monthly" {
+		return to.AddDate(0, -1, 0)
+	}
+	return to.AddDate(0, 0, -7)
+}
+
+// actual staking rate statistics of time range [from, to) from the staking rate database, or from the rate buffer
+// if no database is configured. <n> is the number of blocks, it is 0 for the rate buffer which holds per minute
+// samples.
+func digestStakingRates(from, to int64) (avgRate, minRate, maxRate float64, n int, ok bool) {
+	if g_db == nil {
+		return digestBufferRates(from, to)
+	}
+
+	var avgV, minV, maxV sql.NullFloat64
+
+	err := g_db.QueryRow("SELECT avg(actual_rate), min(actual_rate), max(actual_rate), count(*) FROM stakingratestats WHERE block_time >= $1 AND block_time < $2",
+		from, to).Scan(&avgV, &minV, &maxV, &n)
+
+	if err != nil {
+		fmt.Printf("digestStakingRates: db query failed: %v\n", err)
+		return
+	}
+
+	if n == 0 {
+		return
+	}
+
+	return avgV.Float64, minV.Float64, maxV.Float64, n, true
+}
+
+func digestBufferRates(from, to int64) (avgRate, minRate, maxRate float64, n int, ok bool) {
+	cnt := 0
+	sum := 0.0
+
+	for _, s := range rateBufferSamples(from) {
+		if s.Time >= to {
+			continue
+		}
+		if cnt == 0 || s.Rate < minRate {
+			minRate = s.Rate
+		}
+		if cnt == 0 || s.Rate > maxRate {
+			maxRate = s.Rate
+		}
+		sum += s.Rate
+		cnt++
+	}
+
+	if cnt == 0 {
+		return
+	}
+
+	return sum / float64(cnt), minRate, maxRate, 0, true
+}
+
+// calculates the share of time in which the particld watchdog reported normal operation and the number of alerts
+// of all watchdogs in time range [from, to). Only time covered by particld watchdog events is taken into account.
+func digestUptime(events []WatchdogEvent, from, to int64) (uptime float64, alerts int, ok bool) {
+	var observed, up int64
+	var node []WatchdogEvent
+
+	for _, ev := range events {
+		if !ev.Ok && ev.Time >= from {
+			alerts++
+		}
+		if ev.Source == "particld" {
+			node = append(node, ev)
+		}
+	}
+
+	for i, ev := range node {
+		start := ev.Time
+		if start < from {
+			start = from
+		}
+		end := to
+		if i+1 < len(node) {
+			end = node[i+1].Time
+		}
+		if end <= start {
+			continue
+		}
+
+		observed += end - start
+		if ev.Ok {
+			up += end - start
+		}
+	}
+
+	if observed == 0 {
+		return 0, alerts, false
+	}
+
+	return float64(up) * 100 / float64(observed), alerts, true
+}
+
+func buildDigest(period string, to time.Time) Digest {
+	d := Digest{Period: period, To: to, From: digestPeriodStart(period, to)}
+	from := d.From.Unix()
+
+	d.AvgRate, d.MinRate, d.MaxRate, d.Blocks, d.RatesOk = digestStakingRates(from, to.Unix())
+
+	var first, last NodeStatsSample
+	first, last, d.WeightOk = nodeStatsRange(from, to.Unix())
+	d.WeightStart = first.Weight
+	d.WeightEnd = last.Weight
+
+	d.Uptime, d.Alerts, d.UptimeOk = digestUptime(watchdogEvents(from, to.Unix()), from, to.Unix())
+
+	return d
+}
+
+func (d *Digest) Title(lang string) string {
+	if d.Period == "monthly" {
+		return tr(lang, "monthly_digest")
+	}
+	return tr(lang, "weekly_digest")
+}
+
+// fixed width text of the digest figures
+func (d *Digest) Text(lang string) string {
+	na := "n/a"
+	percent := func(v float64) string { return formatNumber(lang, v, 2) + " %" }
+
+	rows := [][2]string{
+		{tr(lang, "lbl_from"), d.From.UTC().Format("2006-01-02 15:04 MST")},
+		{tr(lang, "lbl_to"), d.To.UTC().Format("2006-01-02 15:04 MST")},
+	}
+
+	if d.RatesOk {
+		rows = append(rows, [2]string{tr(lang, "lbl_actual_avg"), percent(d.AvgRate)},
+			[2]string{tr(lang, "lbl_actual_min"), percent(d.MinRate)},
+			[2]string{tr(lang, "lbl_actual_max"), percent(d.MaxRate)})
+		if d.Blocks > 0 {
+			rows = append(rows, [2]string{tr(lang, "lbl_blocks"), formatNumber(lang, float64(d.Blocks), 0)})
+		}
+	} else {
+		rows = append(rows, [2]string{tr(lang, "lbl_actual_rate"), na})
+	}
+
+	if d.WeightOk {
+		change := d.WeightEnd - d.WeightStart
+		chg := formatPart(lang, float64(change)/SatPerPart, 0)
+		if change >= 0 {
+			chg = "+" + chg
+		}
+		if d.WeightStart > 0 {
+			chg += fmt.Sprintf(" (%+.1f %%)", float64(change)*100/float64(d.WeightStart))
+		}
+		rows = append(rows, [2]string{tr(lang, "lbl_staking"), formatPart(lang, float64(d.WeightEnd)/SatPerPart, 0)},
+			[2]string{tr(lang, "lbl_staking_chg"), chg})
+	} else {
+		rows = append(rows, [2]string{tr(lang, "lbl_staking_chg"), na})
+	}
+
+	if d.UptimeOk {
+		rows = append(rows, [2]string{tr(lang, "lbl_uptime"), percent(d.Uptime)})
+	} else {
+		rows = append(rows, [2]string{tr(lang, "lbl_uptime"), na})
+	}
+	rows = append(rows, [2]string{tr(lang, "lbl_alerts"), fmt.Sprintf("%d", d.Alerts)})
+
+	return infoTable(rows)
+}
+
+func telegramReportDigest(chatId int64, period string) bool {
+	lang := telegramChatLanguage(chatId)
+	d := buildDigest(period, time.Now())
+	return telegramSendFormatted(chatId, newTgMsg().Bold(d.Title(lang)).Text("\n").Pre(d.Text(lang)))
+}
+
+func telegramReportWeeklyDigest(chatId int64) bool {
+	return telegramReportDigest(chatId, "weekly")
+}
+
+func telegramReportMonthlyDigest(chatId int64) bool {
+	return telegramReportDigest(chatId, "monthly")
+}
+
+// sends digest emails according to the configured digest periods, schedules are evaluated in UTC
+func digestMailer() {
+	type job struct {
+		period string
+		cron   *cronSchedule
+		next   time.Time
+	}
+
+	var jobs []*job
+
+	for _, p := range g_config.DigestEmailPeriods {
+		expr, ok := g_digestPeriods[p]
+		if !ok {
+			fmt.Printf("Digest: invalid period \"%s\"\n", p)
+			continue
+		}
+		c, err := parseCron(expr, time.UTC)
+		if err != nil {
+			fmt.Printf("Digest: %v\n", err)
+			continue
+		}
+		jobs = append(jobs, &job{p, c, c.Next(time.Now())})
+		fmt.Printf("Digest: sending %s digest to %s\n", p, g_config.DigestEmailTo)
+	}
+
+	if len(jobs) == 0 {
+		return
+	}
+
+	for {
+		wait := time.Hour
+
+		for _, j := range jobs {
+			if !j.next.After(time.Now()) {
+				d := buildDigest(j.period, j.next)
+				lang := watchdogLanguage()
+				sendEmail(g_config.DigestEmailTo, digestEmailFrom(), d.Title(lang), d.Text(lang), false)
+				j.next = j.cron.Next(time.Now())
+			}
+			if w := time.Until(j.next); w < wait {
+				wait = w
+			}
+		}
+
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func digestEmailFrom() string {
+	if g_config.DigestEmailFrom != "" {
+		return g_config.DigestEmailFrom
+	}
+	return g_config.WatchdogEmailFrom
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const eventsDefaultMaxSubscribers = 50
+const eventsHeartbeatInterval = 15 * time.Second
+
+// number of past events kept for clients resuming with Last-Event-ID
+const eventsHistorySize = 100
+
+// events queued per subscriber, slow subscribers exceeding this are disconnected
+const eventsSubscriberQueue = 32
+
+type serverEvent struct {
+	Id   int64
+	Type string
+	Data []byte
+}
+
+type eventSubscriber struct {
+	ch     chan serverEvent
+	closed bool
+}
+
+// event IDs are <epoch>-<n> with the start time of the process as epoch, so that IDs of a previous run are not
+// mistaken for IDs of this run
+var g_eventsEpoch = strconv.FormatInt(time.Now().Unix(), 10)
+
+var g_events []serverEvent
+var g_eventsLastId int64
+var g_eventSubscribers = make(map[*eventSubscriber]bool)
+var g_eventsDone = make(chan struct{})
+var g_eventsMutex sync.Mutex
+
+// publishes an event of type <typ> with JSON encoded <v> to all subscribers of the event stream
+func eventsPublish(typ string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Printf("eventsPublish: marshal: %v\n", err)
+		return
+	}
+
+	g_eventsMutex.Lock()
+	defer g_eventsMutex.Unlock()
+
+	g_eventsLastId++
+	ev := serverEvent{g_eventsLastId, typ, data}
+
+	g_events = append(g_events, ev)
+	if len(g_events) > eventsHistorySize {
+		g_events = g_events[len(g_events)-eventsHistorySize:]
+	}
+
+	for s := range g_eventSubscribers {
+		select {
+		case s.ch <- ev:
+		default:
+			// subscriber does not keep up, it may resume with Last-Event-ID after reconnecting
+			eventsUnsubscribeLocked(s)
+		}
+	}
+}
+
+// registers a subscriber and returns the events after <lastId>, fails if the subscriber limit is reached.
+// <resumed> is false if the events after <lastId> are no longer available.
+func eventsSubscribe(lastId int64) (s *eventSubscriber, missed []serverEvent, resumed bool, ok bool) {
+	g_eventsMutex.Lock()
+	defer g_eventsMutex.Unlock()
+
+	max := g_config.EventsMaxSubscribers
+	if max <= 0 {
+		max = eventsDefaultMaxSubscribers
+	}
+	if len(g_eventSubscribers) >= max {
+		return nil, nil, false, false
+	}
+
+	s = &eventSubscriber{ch: make(chan serverEvent, eventsSubscriberQueue)}
+	g_eventSubscribers[s] = true
+
+	if lastId > 0 && lastId <= g_eventsLastId && (len(g_events) == 0 || g_events[0].Id <= lastId+1) {
+		resumed = true
+		for _, ev := range g_events {
+			if ev.Id > lastId {
+				missed = append(missed, ev)
+			}
+		}
+	}
+
+	return s, missed, resumed, true
+}
+
+func eventsUnsubscribe(s *eventSubscriber) {
+	g_eventsMutex.Lock()
+	eventsUnsubscribeLocked(s)
+	g_eventsMutex.Unlock()
+}
+
+func eventsUnsubscribeLocked(s *eventSubscriber) {
+	if !s.closed {
+		s.closed = true
+		delete(g_eventSubscribers, s)
+		close(s.ch)
+	}
+}
+
+// terminates all event streams, registered as shutdown function of the HTTP server
+func eventsShutdown() {
+	close(g_eventsDone)
+}
+
+// writes <ev> in event stream format, events with ID 0 are sent without ID
+func writeServerEvent(w io.Writer, ev serverEvent) error {
+	var err error
+	if ev.Id == 0 {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, ev.Data)
+	} else {
+		_, err = fmt.Fprintf(w, "id: %s-%d\nevent: %s\ndata: %s\n\n", g_eventsEpoch, ev.Id, ev.Type, ev.Data)
+	}
+	return err
+}
+
+// parses an event ID sent by a reconnecting client, returns 0 if the ID is invalid or of a previous run
+func parseEventId(v string) int64 {
+	epoch, n, ok := strings.Cut(v, "-")
+	if !ok || epoch != g_eventsEpoch {
+		return 0
+	}
+
+	id, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// GET /events, server-sent events stream with event types status, block and watchdog
+func handleEvents(resp http.ResponseWriter, req *http.Request) {
+	lastId := int64(0)
+	if v := req.Header.Get("Last-Event-ID"); v != "" {
+		lastId = parseEventId(v)
+	} else if v := req.URL.Query().Get("lastEventId"); v != "" {
+		lastId = parseEventId(v)
+	}
+
+	s, missed, resumed, ok := eventsSubscribe(lastId)
+	if !ok {
+		resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+		resp.Header().Set("Retry-After", "60")
+		writeJsonError(resp, http.StatusServiceUnavailable, "too_many_subscribers")
+		return
+	}
+	defer eventsUnsubscribe(s)
+
+	// the stream is kept open beyond the server's write timeout
+	rc := http.NewResponseController(resp)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		fmt.Printf("handleEvents: clearing write deadline failed: %v\n", err)
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+	resp.WriteHeader(http.StatusOK)
+
+	io.WriteString(resp, "retry: 5000\n\n")
+
+	if !resumed {
+		// new or unresumable client, start with the current status, which is not a published event and has no ID
+		g_particldStatusMutex.Lock()
+		status := g_particldStatus
+		g_particldStatusMutex.Unlock()
+
+		data, err := json.Marshal(status)
+		if err != nil {
+			fmt.Printf("handleEvents: marshal: %v\n", err)
+		}
+
+		missed = []serverEvent{{0, "status", data}}
+	}
+
+	for _, ev := range missed {
+		if writeServerEvent(resp, ev) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case ev, ok := <-s.ch:
+			if !ok {
+				return
+			}
+			if writeServerEvent(resp, ev) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(resp, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		case <-g_eventsDone:
+			return
+		}
+
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
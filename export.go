@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const exportFlushRows = 1000
+
+// parses a time given as unix time, date (YYYY-MM-DD, UTC) or RFC 3339 time
+func parseTimeParam(s string) (int64, error) {
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Unix(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+// writes staking rate records as CSV or JSON Lines
+type rateExportWriter struct {
+	w   io.Writer
+	csv *csv.Writer
+}
+
+func newRateExportWriter(w io.Writer, format string) *rateExportWriter {
+	if format == "jsonl" {
+		return &rateExportWriter{w: w}
+	}
+	return &rateExportWriter{w: w, csv: csv.NewWriter(w)}
+}
+
+func (e *rateExportWriter) write(header []string, values []interface{}) error {
+	if e.csv == nil {
+		// JSON objects are written manually to keep the field order of the CSV header
+		line := []byte{'{'}
+		for i, h := range header {
+			v, err := json.Marshal(values[i])
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				line = append(line, ',')
+			}
+			line = append(line, '"')
+			line = append(line, h...)
+			line = append(line, '"', ':')
+			line = append(line, v...)
+		}
+		line = append(line, '}', '\n')
+		_, err := e.w.Write(line)
+		return err
+	}
+
+	fields := make([]string, len(values))
+	for i, v := range values {
+		switch x := v.(type) {
+		case float64:
+			fields[i] = strconv.FormatFloat(x, 'f', -1, 64)
+		default:
+			fields[i] = fmt.Sprint(x)
+		}
+	}
+	return e.csv.Write(fields)
+}
+
+func (e *rateExportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
+
+// streams staking rate records of time range [from, to) to <w>, raw records if <interval> is 0, otherwise
+// aggregated in buckets of <interval> seconds. <flush> is called periodically after records were written.
+func exportStakingRates(w io.Writer, from, to, interval int64, format string, flush func()) (int, error) {
+	var header []string
+	var query string
+	var args []interface{}
+
+	if interval > 0 {
+		header = []string{"time", "avg_rate", "min_rate", "max_rate", "blocks"}
+		query = "SELECT block_time/$3*$3 AS t, avg(actual_rate), min(actual_rate), max(actual_rate), count(*) FROM stakingratestats WHERE block_time >= $1 AND block_time < $2 GROUP BY t ORDER BY t"
+		args = []interface{}{from, to, interval}
+	} else {
+		header = []string{"block_nr", "block_time", "nominal_rate", "actual_rate"}
+		query = "SELECT block_nr, block_time, nominal_rate, actual_rate FROM stakingratestats WHERE block_time >= $1 AND block_time < $2 ORDER BY block_nr"
+		args = []interface{}{from, to}
+	}
+
+	rows, err := g_db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	ew := newRateExportWriter(w, format)
+
+	if ew.csv != nil {
+		if err := ew.csv.Write(header); err != nil {
+			return 0, err
+		}
+	}
+
+	n := 0
+	for rows.Next() {
+		var values []interface{}
+
+		if interval > 0 {
+			var t int64
+			var avgRate, minRate, maxRate float64
+			var blocks int
+			if err := rows.Scan(&t, &avgRate, &minRate, &maxRate, &blocks); err != nil {
+				return n, err
+			}
+			values = []interface{}{t, avgRate, minRate, maxRate, blocks}
+		} else {
+			var blockNr, blockTime int64
+			var nominalRate, actualRate float64
+			if err := rows.Scan(&blockNr, &blockTime, &nominalRate, &actualRate); err != nil {
+				return n, err
+			}
+			values = []interface{}{blockNr, blockTime, nominalRate, actualRate}
+		}
+
+		if err := ew.write(header, values); err != nil {
+			return n, err
+		}
+		n++
+
+		if n%exportFlushRows == 0 {
+			if err := ew.flush(); err != nil {
+				return n, err
+			}
+			if flush != nil {
+				flush()
+			}
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	return n, ew.flush()
+}
+
+type exportParams struct {
+	From     int64
+	To       int64
+	Interval int64
+	Format   string
+}
+
+// validates export parameters, returns error message or empty string
+func (p *exportParams) check() string {
+	if p.Format != "csv" && p.Format != "jsonl" {
+		return "invalid_format"
+	}
+	if p.Interval != 0 && (p.Interval < rateQueryMinInterval || p.Interval > rateQueryMaxInterval) {
+		return "invalid_interval"
+	}
+	if p.From < 0 || p.From >= p.To {
+		return "invalid_range"
+	}
+	return ""
+}
+
+// GET /stakingrate/export?from=<time>&to=<time>[&interval=<interval>][&format=csv|jsonl][&gzip=1]
+func handleStakingRateExport(resp http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	var err error
+
+	p := exportParams{To: time.Now().Unix(), Format: "csv"}
+
+	if v := q.Get("format"); v != "" {
+		p.Format = v
+	}
+	if v := q.Get("to"); v != "" {
+		if p.To, err = parseTimeParam(v); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_to")
+			return
+		}
+	}
+	p.From = p.To - 30*SecondsPerDay
+	if v := q.Get("from"); v != "" {
+		if p.From, err = parseTimeParam(v); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_from")
+			return
+		}
+	}
+	if v := q.Get("interval"); v != "" {
+		if p.Interval, err = parseInterval(v); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_interval")
+			return
+		}
+	}
+
+	if msg := p.check(); msg != "" {
+		writeJsonError(resp, http.StatusBadRequest, msg)
+		return
+	}
+
+	if g_db == nil {
+		writeJsonError(resp, http.StatusServiceUnavailable, "no_database")
+		return
+	}
+
+	// exports may take longer than the server's write timeout
+	rc := http.NewResponseController(resp)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		fmt.Printf("handleStakingRateExport: clearing write deadline failed: %v\n", err)
+	}
+
+	filename := fmt.Sprintf("stakingrates-%s-%s.%s", time.Unix(p.From, 0).UTC().Format("20060102"),
+		time.Unix(p.To, 0).UTC().Format("20060102"), p.Format)
+
+	if p.Format == "jsonl" {
+		resp.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	} else {
+		resp.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	var w io.Writer = resp
+	var gz *gzip.Writer
+
+	if q.Get("gzip") == "1" || q.Get("gzip") == "true" {
+		filename += ".gz"
+		resp.Header().Set("Content-Type", "application/gzip")
+		gz = gzip.NewWriter(resp)
+		w = gz
+	}
+	resp.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	flush := func() {
+		if gz != nil {
+			gz.Flush()
+		}
+		rc.Flush()
+	}
+
+	n, err := exportStakingRates(w, p.From, p.To, p.Interval, p.Format, flush)
+	if err != nil {
+		// the response status is already sent, the truncated response is the only indication of the error
+		fmt.Printf("handleStakingRateExport: export failed after %d records: %v\n", n, err)
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			fmt.Printf("handleStakingRateExport: closing gzip stream failed: %v\n", err)
+		}
+	}
+}
+
+// runs the export subcommand: export <config file> [-from <time>] [-to <time>] [-interval <interval>]
+// [-format csv|jsonl] [-gzip] [-o <file>]
+func exportMain(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s export <config file> [-from <time>] [-to <time>] [-interval <interval>] [-format csv|jsonl] [-gzip] [-o <file>]\n", g_prgName)
+		return 1
+	}
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fromStr := fs.String("from", "", "start of time range: unix time, YYYY-MM-DD or RFC 3339 time, defaults to 30 days before end")
+	toStr := fs.String("to", "", "end of time range, defaults to now")
+	intervalStr := fs.String("interval", "", "bucket size for aggregated records, e.g. 1h or 1d, raw records if not given")
+	format := fs.String("format", "csv", "output format: csv or jsonl")
+	compress := fs.Bool("gzip", false, "gzip output")
+	outFile := fs.String("o", "", "output file, defaults to stdout")
+	fs.Parse(args[1:])
+
+	// stdout carries the exported data, messages of the shared config and database functions go to stderr
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	if !readConfig(args[0]) {
+		fmt.Fprintf(os.Stderr, "%s: Failed to read config file.\n", g_prgName)
+		return 1
+	}
+	if g_config.DbUrl == "" {
+		fmt.Fprintf(os.Stderr, "%s: No database configured.\n", g_prgName)
+		return 1
+	}
+
+	p := exportParams{To: time.Now().Unix(), Format: *format}
+	var err error
+
+	if *toStr != "" {
+		if p.To, err = parseTimeParam(*toStr); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid end time: %v\n", err)
+			return 1
+		}
+	}
+	p.From = p.To - 30*SecondsPerDay
+	if *fromStr != "" {
+		if p.From, err = parseTimeParam(*fromStr); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid start time: %v\n", err)
+			return 1
+		}
+	}
+	if *intervalStr != "" {
+		if p.Interval, err = parseInterval(*intervalStr); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid interval: %v\n", err)
+			return 1
+		}
+	}
+	if msg := p.check(); msg != "" {
+		fmt.Fprintf(os.Stderr, "Invalid parameters: %s\n", msg)
+		return 1
+	}
+
+	g_db = dbConnect()
+	if g_db == nil {
+		return 1
+	}
+	defer g_db.Close()
+
+	out := stdout
+	if *outFile != "" {
+		if out, err = os.Create(*outFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file: %v\n", err)
+			return 1
+		}
+	}
+
+	bw := bufio.NewWriter(out)
+	var w io.Writer = bw
+	var gz *gzip.Writer
+	if *compress {
+		gz = gzip.NewWriter(bw)
+		w = gz
+	}
+
+	n, err := exportStakingRates(w, p.From, p.To, p.Interval, p.Format, nil)
+
+	if gz != nil {
+		if cerr := gz.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if ferr := bw.Flush(); ferr != nil && err == nil {
+		err = ferr
+	}
+	if out != stdout {
+		if cerr := out.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed after %d records: %v\n", n, err)
+		if out != stdout {
+			// do not leave a truncated export behind
+			if rerr := os.Remove(*outFile); rerr != nil {
+				fmt.Fprintf(os.Stderr, "Failed to remove output file: %v\n", rerr)
+			}
+		}
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d records.\n", n)
+	return 0
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// watchdog state change, <Source> is the monitored service: "particld" or "pool"
+type WatchdogEvent struct {
+	Time    int64  `json:"time"`
+	Source  string `json:"source"`
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+type NodeStatsSample struct {
+	Time        int64   `json:"time"`
+	Weight      int64   `json:"weight"`
+	NetWeight   int64   `json:"net_weight"`
+	MoneySupply float64 `json:"money_supply"`
+	Peers       int     `json:"peers"`
+
+	// set if network weight, money supply and peers were recorded, samples of older versions have the weight only
+	Network bool `json:"-"`
+}
+
+// maximum number of watchdog events and node stats samples kept in memory
+const maxWatchdogEvents = 1000
+const maxNodeStatsSamples = 24 * 400
+
+const nodeStatsSampleInterval = 60 * 60
+
+const watchdogEventsDefaultDays = 7
+const watchdogEventsMaxDays = 90
+const watchdogEventsMaxCount = 100
+
+var g_watchdogEvents []WatchdogEvent
+var g_nodeStatsSamples []NodeStatsSample
+var g_historyMutex sync.Mutex
+
+// set if the history tables are available in the database, otherwise history is kept in memory only
+var g_dbTables bool
+
+// creates tables owned by the server
+func dbInit() bool {
+	stmts := []string{
+		"CREATE TABLE IF NOT EXISTS watchdogevents (event_time BIGINT NOT NULL, ok BOOLEAN NOT NULL, message TEXT NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS watchdogevents_time ON watchdogevents (event_time)",
+		"ALTER TABLE watchdogevents ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'particld'",
+		"CREATE TABLE IF NOT EXISTS nodestats (sample_time BIGINT PRIMARY KEY, weight BIGINT NOT NULL)",
+		"ALTER TABLE nodestats ADD COLUMN IF NOT EXISTS net_weight BIGINT",
+		"ALTER TABLE nodestats ADD COLUMN IF NOT EXISTS money_supply DOUBLE PRECISION",
+		"ALTER TABLE nodestats ADD COLUMN IF NOT EXISTS peers INTEGER",
+		"CREATE TABLE IF NOT EXISTS poolblocks (block_nr BIGINT PRIMARY KEY, block_hash TEXT NOT NULL, block_time BIGINT NOT NULL, reward BIGINT NOT NULL)",
+		"CREATE INDEX IF NOT EXISTS poolblocks_time ON poolblocks (block_time)",
+	}
+
+	for _, s := range stmts {
+		if _, err := g_db.Exec(s); err != nil {
+			fmt.Printf("dbInit: %v\n", err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// records a watchdog state change
+func watchdogRecordEvent(source string, ok bool, msg string) {
+	ev := WatchdogEvent{time.Now().Unix(), source, ok, msg}
+
+	g_historyMutex.Lock()
+	g_watchdogEvents = append(g_watchdogEvents, ev)
+	if len(g_watchdogEvents) > maxWatchdogEvents {
+		g_watchdogEvents = g_watchdogEvents[len(g_watchdogEvents)-maxWatchdogEvents:]
+	}
+	g_historyMutex.Unlock()
+
+	if g_dbTables {
+		_, err := g_db.Exec("INSERT INTO watchdogevents (event_time, source, ok, message) VALUES ($1, $2, $3, $4)",
+			ev.Time, ev.Source, ev.Ok, ev.Message)
+		if err != nil {
+			fmt.Printf("watchdogRecordEvent: db insert failed: %v\n", err)
+		}
+	}
+}
+
+// returns watchdog events in time range [from, to) in ascending time order, preceded by the last event of each
+// source before <from>
+func watchdogEvents(from, to int64) []WatchdogEvent {
+	var res []WatchdogEvent
+
+	if g_dbTables {
+		rows, err := g_db.Query("(SELECT DISTINCT ON (source) event_time, source, ok, message FROM watchdogevents WHERE event_time < $1 ORDER BY source, event_time DESC) "+
+			"UNION ALL (SELECT event_time, source, ok, message FROM watchdogevents WHERE event_time >= $1 AND event_time < $2) ORDER BY event_time",
+			from, to)
+
+		if err != nil {
+			fmt.Printf("watchdogEvents: db query failed: %v\n", err)
+			return nil
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var ev WatchdogEvent
+			if err := rows.Scan(&ev.Time, &ev.Source, &ev.Ok, &ev.Message); err != nil {
+				fmt.Printf("watchdogEvents: db scan failed: %v\n", err)
+				return nil
+			}
+			res = append(res, ev)
+		}
+
+		if err := rows.Err(); err != nil {
+			fmt.Printf("watchdogEvents: db next row failed: %v\n", err)
+		}
+
+		return res
+	}
+
+	g_historyMutex.Lock()
+	defer g_historyMutex.Unlock()
+
+	for i, ev := range g_watchdogEvents {
+		if ev.Time >= to {
+			break
+		}
+		if ev.Time < from {
+			superseded := false
+			for _, next := range g_watchdogEvents[i+1:] {
+				if next.Time >= from {
+					break
+				}
+				if next.Source == ev.Source {
+					superseded = true
+					break
+				}
+			}
+			if superseded {
+				continue
+			}
+		}
+		res = append(res, ev)
+	}
+
+	return res
+}
+
+// records a node stats sample if the last sample is older than the sample interval
+func nodeStatsRecord(sample NodeStatsSample) {
+	now := time.Now().Unix()
+
+	g_historyMutex.Lock()
+	n := len(g_nodeStatsSamples)
+	if n > 0 && now-g_nodeStatsSamples[n-1].Time < nodeStatsSampleInterval {
+		g_historyMutex.Unlock()
+		return
+	}
+
+	sample.Time = now
+	g_nodeStatsSamples = append(g_nodeStatsSamples, sample)
+	if len(g_nodeStatsSamples) > maxNodeStatsSamples {
+		g_nodeStatsSamples = g_nodeStatsSamples[len(g_nodeStatsSamples)-maxNodeStatsSamples:]
+	}
+	g_historyMutex.Unlock()
+
+	if !g_dbTables {
+		nodeStatsSave()
+		return
+	}
+
+	// network fields of incomplete samples are stored as NULL like those of samples of older versions
+	var netWeight, moneySupply, peers interface{}
+	if sample.Network {
+		netWeight, moneySupply, peers = sample.NetWeight, sample.MoneySupply, sample.Peers
+	}
+
+	_, err := g_db.Exec("INSERT INTO nodestats (sample_time, weight, net_weight, money_supply, peers) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING",
+		sample.Time, sample.Weight, netWeight, moneySupply, peers)
+	if err != nil {
+		fmt.Printf("nodeStatsRecord: db insert failed: %v\n", err)
+	}
+}
+
+// node stats sample as stored in the node stats file
+type nodeStatsFileSample struct {
+	NodeStatsSample
+	Network bool `json:"network"`
+}
+
+// writes the node stats samples kept in memory to the configured node stats file
+func nodeStatsSave() {
+	if g_config.NodeStatsFile == "" {
+		return
+	}
+
+	g_historyMutex.Lock()
+	samples := make([]nodeStatsFileSample, len(g_nodeStatsSamples))
+	for i, s := range g_nodeStatsSamples {
+		samples[i] = nodeStatsFileSample{s, s.Network}
+	}
+	g_historyMutex.Unlock()
+
+	data, err := json.Marshal(samples)
+	if err != nil {
+		fmt.Printf("nodeStatsSave: Marshal: %v\n", err)
+		return
+	}
+
+	tmpFile := g_config.NodeStatsFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		fmt.Printf("nodeStatsSave: write failed: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmpFile, g_config.NodeStatsFile); err != nil {
+		fmt.Printf("nodeStatsSave: rename failed: %v\n", err)
+	}
+}
+
+// restores the node stats samples kept in memory from the configured node stats file
+func nodeStatsLoad() {
+	if g_config.NodeStatsFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(g_config.NodeStatsFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("nodeStatsLoad: read failed: %v\n", err)
+		}
+		return
+	}
+
+	var samples []nodeStatsFileSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		fmt.Printf("nodeStatsLoad: syntax error in %s: %v\n", g_config.NodeStatsFile, err)
+		return
+	}
+
+	if len(samples) > maxNodeStatsSamples {
+		samples = samples[len(samples)-maxNodeStatsSamples:]
+	}
+
+	g_historyMutex.Lock()
+	g_nodeStatsSamples = g_nodeStatsSamples[:0]
+	for _, s := range samples {
+		s.NodeStatsSample.Network = s.Network
+		g_nodeStatsSamples = append(g_nodeStatsSamples, s.NodeStatsSample)
+	}
+	g_historyMutex.Unlock()
+
+	fmt.Printf("Loaded %d node stats samples from %s.\n", len(samples), g_config.NodeStatsFile)
+}
+
+// returns first and last node stats sample in time range [from, to)
+func nodeStatsRange(from, to int64) (first, last NodeStatsSample, ok bool) {
+	if g_dbTables {
+		err := g_db.QueryRow("SELECT sample_time, weight FROM nodestats WHERE sample_time >= $1 AND sample_time < $2 ORDER BY sample_time LIMIT 1",
+			from, to).Scan(&first.Time, &first.Weight)
+		if err != nil {
+			return first, last, false
+		}
+		err = g_db.QueryRow("SELECT sample_time, weight FROM nodestats WHERE sample_time >= $1 AND sample_time < $2 ORDER BY sample_time DESC LIMIT 1",
+			from, to).Scan(&last.Time, &last.Weight)
+		if err != nil {
+			fmt.Printf("nodeStatsRange: db query failed: %v\n", err)
+			return first, last, false
+		}
+		return first, last, true
+	}
+
+	g_historyMutex.Lock()
+	defer g_historyMutex.Unlock()
+
+	for _, s := range g_nodeStatsSamples {
+		if s.Time < from || s.Time >= to {
+			continue
+		}
+		if !ok {
+			first = s
+			ok = true
+		}
+		last = s
+	}
+
+	return first, last, ok
+}
+
+// returns node stats samples in time range [from, to) in ascending time order
+func nodeStatsSamples(from, to int64) ([]NodeStatsSample, error) {
+	var res []NodeStatsSample
+
+	if g_dbTables {
+		rows, err := g_db.Query("SELECT sample_time, weight, net_weight, money_supply, peers FROM nodestats WHERE sample_time >= $1 AND sample_time < $2 ORDER BY sample_time",
+			from, to)
+		if err != nil {
+			fmt.Printf("nodeStatsSamples: db query failed: %v\n", err)
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s NodeStatsSample
+			var netWeight, peers sql.NullInt64
+			var moneySupply sql.NullFloat64
+
+			if err := rows.Scan(&s.Time, &s.Weight, &netWeight, &moneySupply, &peers); err != nil {
+				fmt.Printf("nodeStatsSamples: db scan failed: %v\n", err)
+				return nil, err
+			}
+
+			s.NetWeight = netWeight.Int64
+			s.MoneySupply = moneySupply.Float64
+			s.Peers = int(peers.Int64)
+			s.Network = netWeight.Valid && moneySupply.Valid && peers.Valid
+			res = append(res, s)
+		}
+
+		if err := rows.Err(); err != nil {
+			fmt.Printf("nodeStatsSamples: db next row failed: %v\n", err)
+			return nil, err
+		}
+
+		return res, nil
+	}
+
+	g_historyMutex.Lock()
+	defer g_historyMutex.Unlock()
+
+	for _, s := range g_nodeStatsSamples {
+		if s.Time >= from && s.Time < to {
+			res = append(res, s)
+		}
+	}
+
+	return res, nil
+}
+
+// GET /watchdog/events?days=<days>, watchdog state changes of the last days, newest first
+func handleWatchdogEvents(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	days := watchdogEventsDefaultDays
+	if v := req.URL.Query().Get("days"); v != "" {
+		var err error
+		if days, err = strconv.Atoi(v); err != nil || days < 1 || days > watchdogEventsMaxDays {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_days")
+			return
+		}
+	}
+
+	now := time.Now().Unix()
+	events := watchdogEvents(now-int64(days)*SecondsPerDay, now+1)
+
+	res := make([]WatchdogEvent, 0, len(events))
+	for i := len(events) - 1; i >= 0 && len(res) < watchdogEventsMaxCount; i-- {
+		res = append(res, events[i])
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		fmt.Printf("handleWatchdogEvents: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
@@ -0,0 +1,749 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const defaultLanguage = "en"
+
+type numberFormat struct {
+	Decimal   string
+	Thousands string
+}
+
+var g_numberFormats = map[string]numberFormat{
+	"en": {".", ","},
+	"de": {",", "."},
+	"es": {",", "."},
+}
+
+var g_languageNames = map[string]string{
+	"en": "English",
+	"de": "Deutsch",
+	"es": "Español",
+}
+
+// message catalogs, missing entries fall back to English
+var g_messages = map[string]map[string]string{
+	"en": {
+		"invalid_command":   "Invalid command.",
+		"invalid_request":   "Invalid request.",
+		"permission_denied": "Permission denied.",
+		"hello":             "Hello %s!",
+		"intro":             "This bot is intended to monitor and query the Crymel Particl Cold Staking Pool: https://particl.crymel.icu",
+		"commands":          "Commands:",
+		"admin":             "admin",
+
+		"cmd_start":       "Show intro and help",
+		"cmd_help":        "Show available commands",
+		"cmd_status":      "Get Particl node status",
+		"cmd_accountinfo": "Get account balance in staking pool",
+		"cmd_stakeinfo":   "Get staking interest rate info",
+		"cmd_history":     "Get staking interest rate history chart",
+		"cmd_language":    "Show or set language of this chat",
+		"cmd_stakingoff":  "Disable staking",
+		"arg_account":     "<account id>",
+		"arg_amount":      "[<amount PART>]",
+
+		"node_info":          "Particl Node Info",
+		"lbl_timestamp":      "Timestamp",
+		"lbl_status":         "Status",
+		"lbl_version":        "Version",
+		"lbl_uptime":         "Uptime",
+		"lbl_peers":          "Peers",
+		"lbl_last_block":     "Last Block",
+		"lbl_staking":        "Staking",
+		"lbl_net_staking":    "NetStaking",
+		"lbl_mp_fee_vote":    "MP Fee Vote",
+		"lbl_delegators":     "Delegators",
+		"lbl_cs_utxos":       "CS UTXOs",
+		"lbl_delegated":      "Delegated",
+		"status_staking":     "Staking",
+		"status_not_staking": "Not Staking: %s",
+		"status_comm_error":  "communication error",
+
+		"missing_account":     "Missing account ID argument.",
+		"account_invalid":     "Account ID %s is not valid.",
+		"account_info":        "Staking pool account info for %s:",
+		"total_rewards":       "total rewards",
+		"confirmed_payout":    "confirmed payout",
+		"unconfirmed_payout":  "unconfirmed payout",
+		"open_payout":         "open payout",
+		"last_staking_weight": "last staking weight",
+		"account_error":       "Error while retrieving account information - try again later.",
+		"account_not_found":   "Account ID %s is not known to the staking pool.",
+		"pool_down":           "Staking pool server is not available - try again later.",
+		"pool_timeout":        "Staking pool server did not respond in time - try again later.",
+
+		"invalid_amount": "PART amount value \"%s\" is not valid.",
+		"nominal_rate":   "Nominal annual staking interest rate: %s",
+		"actual_rate":    "Actual annual staking interest rate: %s",
+		"rolling_rate":   "Average actual rate 7 days: %s, 30 days: %s",
+		"nominal_reward": "Nominal daily reward for staking %s: %s",
+		"actual_reward":  "Actual daily reward for staking %s: %s",
+
+		"invalid_history":        "Invalid history type \"%s\", use hourly, daily, network or weight.",
+		"no_history":             "No staking rate history available.",
+		"history_caption_daily":  "Actual annual staking interest rate, last 30 days (UTC)",
+		"history_caption_hourly": "Actual annual staking interest rate, last 24 hours (UTC)",
+		"history_legend":         "avg (blue), 10th/90th percentile (grey)",
+		"history_table":          "Actual annual staking interest rate (UTC)",
+		"col_time":               "Time",
+		"col_avg":                "Avg",
+		"col_min":                "Min",
+		"col_max":                "Max",
+
+		"history_caption_network": "Network staking weight and money supply in million PART, last 30 days (UTC)",
+		"network_legend":          "network staking weight (blue), money supply (grey)",
+		"network_participation":   "Network participation: %s %%",
+		"history_caption_weight":  "Staking weight of the pool in thousand PART, last 30 days (UTC)",
+		"no_network_stats":        "No network statistics available.",
+		"network_table":           "Network staking weight and money supply in million PART, pool staking weight in thousand PART (UTC)",
+		"col_net_weight":          "NetWeight",
+		"col_supply":              "Supply",
+		"col_weight":              "Weight",
+
+		"btn_refresh": "Refresh",
+		"btn_rates":   "Staking Rates",
+		"btn_history": "History",
+		"btn_back":    "Back",
+		"btn_hourly":  "Hourly",
+		"btn_daily":   "Daily",
+		"btn_confirm": "Confirm",
+		"btn_cancel":  "Cancel",
+
+		"disable_staking": "Disable staking?",
+		"staking_off":     "Staking off: %s",
+		"cancelled":       "cancelled",
+
+		"language_set":     "Language set to %s.",
+		"language_invalid": "Unsupported language \"%s\", available: %s",
+		"language_current": "Current language: %s, available: %s",
+
+		"weekly_summary":  "Weekly Pool Summary",
+		"lbl_nominal":     "Nominal",
+		"lbl_actual":      "Actual",
+		"lbl_7d_avg":      "7 days avg",
+		"lbl_7d_min":      "7 days min",
+		"lbl_7d_max":      "7 days max",
+		"weekly_digest":   "Weekly Staking Digest",
+		"monthly_digest":  "Monthly Staking Digest",
+		"lbl_from":        "From",
+		"lbl_to":          "To",
+		"lbl_actual_avg":  "Actual avg",
+		"lbl_actual_min":  "Actual min",
+		"lbl_actual_max":  "Actual max",
+		"lbl_actual_rate": "Actual rate",
+		"lbl_blocks":      "Blocks",
+		"lbl_staking_chg": "Staking chg",
+		"lbl_alerts":      "Alerts",
+
+		"wd_prefix":            "Particld watchdog: %s",
+		"wd_normal":            "normal operation",
+		"wd_comm_failed":       "communication to particld failed.",
+		"wd_not_staking":       "particld is not staking, cause: %s",
+		"wd_mail_subject":      "Particld Watchdog Alert",
+		"wd_wallet_not_loaded": "staking wallet %s is not loaded.",
+		"wd_wallet_locked":     "staking wallet is locked",
+		"wd_no_weight":         "no stakeable balance in staking wallet",
+		"wd_weight_drop":       "stakeable weight dropped by %s %% from %s to %s.",
+		"delegation_change":    "Delegation change: %s %s, total delegated: %s",
+		"wd_pool_prefix":       "Stake pool watchdog: %s",
+		"wd_pool_down":         "stake pool server is not reachable.",
+		"wd_pool_timeout":      "stake pool server does not respond.",
+		"wd_pool_slow":         "stake pool server response time %s s exceeds %d s.",
+		"wd_pool_behind":       "stake pool is %d blocks behind the node (pool: %d, node: %d).",
+
+		"cmd_calc":          "Project staking rewards",
+		"arg_calc":          "<amount PART> [<days>] [<pool fee %>]",
+		"calc_usage":        "Usage: /calc <amount PART> [<days>] [<pool fee %>]",
+		"calc_invalid_days": "Number of days \"%s\" is not valid, use 1 to %d.",
+		"calc_invalid_fee":  "Pool fee \"%s\" is not valid, use 0 to 99 %%.",
+		"calc_title":        "Reward projection for %s over %d days",
+		"calc_fee":          "Pool fee: %s %%",
+		"calc_history":      "Range based on %d days of actual staking rate history.",
+		"calc_nominal":      "Nominal",
+		"calc_actual":       "Actual",
+		"calc_history_min":  "History min",
+		"calc_history_avg":  "History avg",
+		"calc_history_max":  "History max",
+		"col_rate":          "Rate %",
+		"col_reward":        "Reward",
+		"col_compound":      "Compounded",
+
+		"cmd_poolinfo":         "Get staking pool statistics",
+		"pool_info":            "Staking Pool Info",
+		"pool_no_data":         "No staking pool statistics available.",
+		"pool_stale":           "Staking pool server is not reachable, statistics may be outdated.",
+		"lbl_updated":          "Updated",
+		"lbl_pool_height":      "Pool height",
+		"lbl_balance":          "Balance",
+		"lbl_accounts":         "Accounts",
+		"lbl_blocks_found":     "Blocks found",
+		"lbl_last_block_found": "Last found",
+		"lbl_pending_payouts":  "Pending payouts",
+
+		"cmd_blocks":     "Get blocks staked by the pool and luck",
+		"pool_luck":      "Pool luck",
+		"pool_blocks":    "Last blocks staked by the pool",
+		"no_pool_blocks": "No blocks staked by the pool recorded.",
+		"col_days":       "Days",
+		"col_found":      "Found",
+		"col_expected":   "Expected",
+		"col_luck":       "Luck",
+	},
+
+	"de": {
+		"invalid_command":   "Ungültiger Befehl.",
+		"invalid_request":   "Ungültige Anfrage.",
+		"permission_denied": "Zugriff verweigert.",
+		"hello":             "Hallo %s!",
+		"intro":             "Dieser Bot dient zur Überwachung und Abfrage des Crymel Particl Cold Staking Pools: https://particl.crymel.icu",
+		"commands":          "Befehle:",
+		"admin":             "Admin",
+
+		"cmd_start":       "Einführung und Hilfe anzeigen",
+		"cmd_help":        "Verfügbare Befehle anzeigen",
+		"cmd_status":      "Status des Particl Nodes abfragen",
+		"cmd_accountinfo": "Kontostand im Staking Pool abfragen",
+		"cmd_stakeinfo":   "Staking-Zinssatz abfragen",
+		"cmd_history":     "Verlauf des Staking-Zinssatzes als Diagramm",
+		"cmd_language":    "Sprache dieses Chats anzeigen oder setzen",
+		"cmd_stakingoff":  "Staking deaktivieren",
+		"arg_account":     "<Konto-ID>",
+		"arg_amount":      "[<Betrag PART>]",
+
+		"node_info":          "Particl Node Info",
+		"lbl_timestamp":      "Zeitpunkt",
+		"lbl_status":         "Status",
+		"lbl_version":        "Version",
+		"lbl_uptime":         "Laufzeit",
+		"lbl_peers":          "Peers",
+		"lbl_last_block":     "Letzter Block",
+		"lbl_staking":        "Staking",
+		"lbl_net_staking":    "Netz-Staking",
+		"lbl_mp_fee_vote":    "MP Gebühr",
+		"lbl_delegators":     "Delegatoren",
+		"lbl_cs_utxos":       "CS UTXOs",
+		"lbl_delegated":      "Delegiert",
+		"status_staking":     "Staking aktiv",
+		"status_not_staking": "Kein Staking: %s",
+		"status_comm_error":  "Kommunikationsfehler",
+
+		"missing_account":     "Konto-ID fehlt.",
+		"account_invalid":     "Konto-ID %s ist ungültig.",
+		"account_info":        "Staking Pool Kontoinformation für %s:",
+		"total_rewards":       "Belohnungen gesamt",
+		"confirmed_payout":    "bestätigte Auszahlung",
+		"unconfirmed_payout":  "unbestätigte Auszahlung",
+		"open_payout":         "offene Auszahlung",
+		"last_staking_weight": "letztes Staking-Gewicht",
+		"account_error":       "Fehler beim Abrufen der Kontoinformation - bitte später erneut versuchen.",
+		"account_not_found":   "Konto-ID %s ist dem Staking Pool nicht bekannt.",
+		"pool_down":           "Der Staking Pool Server ist nicht verfügbar - bitte später erneut versuchen.",
+		"pool_timeout":        "Der Staking Pool Server hat nicht rechtzeitig geantwortet - bitte später erneut versuchen.",
+
+		"invalid_amount": "PART Betrag \"%s\" ist ungültig.",
+		"nominal_rate":   "Nominaler jährlicher Staking-Zinssatz: %s",
+		"actual_rate":    "Tatsächlicher jährlicher Staking-Zinssatz: %s",
+		"rolling_rate":   "Durchschnittlicher Zinssatz 7 Tage: %s, 30 Tage: %s",
+		"nominal_reward": "Nominale tägliche Belohnung für %s: %s",
+		"actual_reward":  "Tatsächliche tägliche Belohnung für %s: %s",
+
+		"invalid_history":        "Ungültiger Verlaufstyp \"%s\", erlaubt sind hourly, daily, network oder weight.",
+		"no_history":             "Kein Verlauf des Staking-Zinssatzes verfügbar.",
+		"history_caption_daily":  "Tatsächlicher jährlicher Staking-Zinssatz, letzte 30 Tage (UTC)",
+		"history_caption_hourly": "Tatsächlicher jährlicher Staking-Zinssatz, letzte 24 Stunden (UTC)",
+		"history_legend":         "Mittel (blau), 10./90. Perzentil (grau)",
+		"history_table":          "Tatsächlicher jährlicher Staking-Zinssatz (UTC)",
+		"col_time":               "Zeit",
+		"col_avg":                "Mittel",
+		"col_min":                "Min",
+		"col_max":                "Max",
+
+		"history_caption_network": "Netzwerk-Staking-Gewicht und Geldmenge in Millionen PART, letzte 30 Tage (UTC)",
+		"network_legend":          "Netzwerk-Staking-Gewicht (blau), Geldmenge (grau)",
+		"network_participation":   "Netzwerkbeteiligung: %s %%",
+		"history_caption_weight":  "Staking-Gewicht des Pools in Tausend PART, letzte 30 Tage (UTC)",
+		"no_network_stats":        "Keine Netzwerkstatistik verfügbar.",
+		"network_table":           "Netzwerk-Staking-Gewicht und Geldmenge in Millionen PART, Staking-Gewicht des Pools in Tausend PART (UTC)",
+		"col_net_weight":          "Netzwerk",
+		"col_supply":              "Geldmenge",
+		"col_weight":              "Gewicht",
+
+		"btn_refresh": "Aktualisieren",
+		"btn_rates":   "Zinssätze",
+		"btn_history": "Verlauf",
+		"btn_back":    "Zurück",
+		"btn_hourly":  "Stündlich",
+		"btn_daily":   "Täglich",
+		"btn_confirm": "Bestätigen",
+		"btn_cancel":  "Abbrechen",
+
+		"disable_staking": "Staking deaktivieren?",
+		"staking_off":     "Staking aus: %s",
+		"cancelled":       "abgebrochen",
+
+		"language_set":     "Sprache auf %s gesetzt.",
+		"language_invalid": "Nicht unterstützte Sprache \"%s\", verfügbar: %s",
+		"language_current": "Aktuelle Sprache: %s, verfügbar: %s",
+
+		"weekly_summary":  "Wöchentliche Pool-Übersicht",
+		"lbl_nominal":     "Nominal",
+		"lbl_actual":      "Tatsächlich",
+		"lbl_7d_avg":      "7 Tage Mittel",
+		"lbl_7d_min":      "7 Tage Min",
+		"lbl_7d_max":      "7 Tage Max",
+		"weekly_digest":   "Wöchentlicher Staking-Bericht",
+		"monthly_digest":  "Monatlicher Staking-Bericht",
+		"lbl_from":        "Von",
+		"lbl_to":          "Bis",
+		"lbl_actual_avg":  "Zins Mittel",
+		"lbl_actual_min":  "Zins Min",
+		"lbl_actual_max":  "Zins Max",
+		"lbl_actual_rate": "Zinssatz",
+		"lbl_blocks":      "Blöcke",
+		"lbl_staking_chg": "Staking Änd.",
+		"lbl_alerts":      "Alarme",
+
+		"wd_prefix":            "Particld Watchdog: %s",
+		"wd_normal":            "normaler Betrieb",
+		"wd_comm_failed":       "Kommunikation mit particld fehlgeschlagen.",
+		"wd_not_staking":       "particld betreibt kein Staking, Ursache: %s",
+		"wd_mail_subject":      "Particld Watchdog Alarm",
+		"wd_wallet_not_loaded": "Staking Wallet %s ist nicht geladen.",
+		"wd_wallet_locked":     "Staking Wallet ist gesperrt",
+		"wd_no_weight":         "kein für Staking verfügbares Guthaben in der Staking Wallet",
+		"wd_weight_drop":       "Staking-Gewicht ist um %s %% von %s auf %s gefallen.",
+		"delegation_change":    "Änderung der Delegation: %s %s, insgesamt delegiert: %s",
+		"wd_pool_prefix":       "Stake Pool Watchdog: %s",
+		"wd_pool_down":         "Stake Pool Server ist nicht erreichbar.",
+		"wd_pool_timeout":      "Stake Pool Server antwortet nicht.",
+		"wd_pool_slow":         "Antwortzeit des Stake Pool Servers von %s s überschreitet %d s.",
+		"wd_pool_behind":       "Stake Pool liegt %d Blöcke hinter dem Node zurück (Pool: %d, Node: %d).",
+
+		"cmd_calc":          "Staking-Erträge hochrechnen",
+		"arg_calc":          "<Betrag PART> [<Tage>] [<Pool-Gebühr %>]",
+		"calc_usage":        "Verwendung: /calc <Betrag PART> [<Tage>] [<Pool-Gebühr %>]",
+		"calc_invalid_days": "Anzahl Tage \"%s\" ist ungültig, erlaubt sind 1 bis %d.",
+		"calc_invalid_fee":  "Pool-Gebühr \"%s\" ist ungültig, erlaubt sind 0 bis 99 %%.",
+		"calc_title":        "Ertragsprognose für %s über %d Tage",
+		"calc_fee":          "Pool-Gebühr: %s %%",
+		"calc_history":      "Bandbreite basierend auf %d Tagen Verlauf des tatsächlichen Staking-Zinssatzes.",
+		"calc_nominal":      "Nominal",
+		"calc_actual":       "Tatsächlich",
+		"calc_history_min":  "Verlauf min",
+		"calc_history_avg":  "Verlauf Ø",
+		"calc_history_max":  "Verlauf max",
+		"col_rate":          "Zins %",
+		"col_reward":        "Ertrag",
+		"col_compound":      "Mit Zinseszins",
+
+		"cmd_poolinfo":         "Statistik des Staking Pools abfragen",
+		"pool_info":            "Staking Pool Info",
+		"pool_no_data":         "Keine Statistik des Staking Pools verfügbar.",
+		"pool_stale":           "Der Staking Pool Server ist nicht erreichbar, die Statistik ist möglicherweise veraltet.",
+		"lbl_updated":          "Aktualisiert",
+		"lbl_pool_height":      "Pool-Höhe",
+		"lbl_balance":          "Guthaben",
+		"lbl_accounts":         "Konten",
+		"lbl_blocks_found":     "Gefundene Blöcke",
+		"lbl_last_block_found": "Zuletzt gefunden",
+		"lbl_pending_payouts":  "Offene Auszahlungen",
+
+		"cmd_blocks":     "Vom Pool gestakte Blöcke und Glück abfragen",
+		"pool_luck":      "Glück des Pools",
+		"pool_blocks":    "Zuletzt vom Pool gestakte Blöcke",
+		"no_pool_blocks": "Keine vom Pool gestakten Blöcke erfasst.",
+		"col_days":       "Tage",
+		"col_found":      "Gef.",
+		"col_expected":   "Erwartet",
+		"col_luck":       "Glück",
+	},
+
+	"es": {
+		"invalid_command":   "Comando no válido.",
+		"invalid_request":   "Solicitud no válida.",
+		"permission_denied": "Permiso denegado.",
+		"hello":             "¡Hola %s!",
+		"intro":             "Este bot sirve para supervisar y consultar el Crymel Particl Cold Staking Pool: https://particl.crymel.icu",
+		"commands":          "Comandos:",
+		"admin":             "admin",
+
+		"cmd_start":       "Mostrar introducción y ayuda",
+		"cmd_help":        "Mostrar los comandos disponibles",
+		"cmd_status":      "Consultar el estado del nodo Particl",
+		"cmd_accountinfo": "Consultar el saldo de la cuenta en el pool",
+		"cmd_stakeinfo":   "Consultar la tasa de interés de staking",
+		"cmd_history":     "Gráfico del historial de la tasa de staking",
+		"cmd_language":    "Mostrar o cambiar el idioma de este chat",
+		"cmd_stakingoff":  "Desactivar staking",
+		"arg_account":     "<id de cuenta>",
+		"arg_amount":      "[<cantidad PART>]",
+
+		"node_info":          "Información del nodo Particl",
+		"lbl_timestamp":      "Fecha",
+		"lbl_status":         "Estado",
+		"lbl_version":        "Versión",
+		"lbl_uptime":         "Activo",
+		"lbl_peers":          "Pares",
+		"lbl_last_block":     "Último bloque",
+		"lbl_staking":        "Staking",
+		"lbl_net_staking":    "Staking red",
+		"lbl_mp_fee_vote":    "Voto tarifa MP",
+		"lbl_delegators":     "Delegadores",
+		"lbl_cs_utxos":       "UTXOs CS",
+		"lbl_delegated":      "Delegado",
+		"status_staking":     "Haciendo staking",
+		"status_not_staking": "Sin staking: %s",
+		"status_comm_error":  "error de comunicación",
+
+		"missing_account":     "Falta el ID de cuenta.",
+		"account_invalid":     "El ID de cuenta %s no es válido.",
+		"account_info":        "Información de la cuenta del pool para %s:",
+		"total_rewards":       "recompensas totales",
+		"confirmed_payout":    "pago confirmado",
+		"unconfirmed_payout":  "pago no confirmado",
+		"open_payout":         "pago pendiente",
+		"last_staking_weight": "último peso de staking",
+		"account_error":       "Error al obtener la información de la cuenta - inténtelo más tarde.",
+		"account_not_found":   "El ID de cuenta %s no es conocido por el pool de staking.",
+		"pool_down":           "El servidor del pool de staking no está disponible - inténtelo más tarde.",
+		"pool_timeout":        "El servidor del pool de staking no respondió a tiempo - inténtelo más tarde.",
+
+		"invalid_amount": "La cantidad de PART \"%s\" no es válida.",
+		"nominal_rate":   "Tasa de interés anual nominal de staking: %s",
+		"actual_rate":    "Tasa de interés anual real de staking: %s",
+		"rolling_rate":   "Tasa real media 7 días: %s, 30 días: %s",
+		"nominal_reward": "Recompensa diaria nominal por %s: %s",
+		"actual_reward":  "Recompensa diaria real por %s: %s",
+
+		"invalid_history":        "Tipo de historial \"%s\" no válido, use hourly, daily, network o weight.",
+		"no_history":             "No hay historial de la tasa de staking disponible.",
+		"history_caption_daily":  "Tasa de interés anual real de staking, últimos 30 días (UTC)",
+		"history_caption_hourly": "Tasa de interés anual real de staking, últimas 24 horas (UTC)",
+		"history_legend":         "media (azul), percentil 10/90 (gris)",
+		"history_table":          "Tasa de interés anual real de staking (UTC)",
+		"col_time":               "Hora",
+		"col_avg":                "Media",
+		"col_min":                "Mín",
+		"col_max":                "Máx",
+
+		"history_caption_network": "Peso de staking de la red y oferta monetaria en millones de PART, últimos 30 días (UTC)",
+		"network_legend":          "peso de staking de la red (azul), oferta monetaria (gris)",
+		"network_participation":   "Participación de la red: %s %%",
+		"history_caption_weight":  "Peso de staking del pool en miles de PART, últimos 30 días (UTC)",
+		"no_network_stats":        "No hay estadísticas de red disponibles.",
+		"network_table":           "Peso de staking de la red y oferta monetaria en millones de PART, peso de staking del pool en miles de PART (UTC)",
+		"col_net_weight":          "Red",
+		"col_supply":              "Oferta",
+		"col_weight":              "Peso",
+
+		"btn_refresh": "Actualizar",
+		"btn_rates":   "Tasas",
+		"btn_history": "Historial",
+		"btn_back":    "Volver",
+		"btn_hourly":  "Por hora",
+		"btn_daily":   "Por día",
+		"btn_confirm": "Confirmar",
+		"btn_cancel":  "Cancelar",
+
+		"disable_staking": "¿Desactivar staking?",
+		"staking_off":     "Staking desactivado: %s",
+		"cancelled":       "cancelado",
+
+		"language_set":     "Idioma cambiado a %s.",
+		"language_invalid": "Idioma \"%s\" no soportado, disponibles: %s",
+		"language_current": "Idioma actual: %s, disponibles: %s",
+
+		"weekly_summary":  "Resumen semanal del pool",
+		"lbl_nominal":     "Nominal",
+		"lbl_actual":      "Real",
+		"lbl_7d_avg":      "Media 7 días",
+		"lbl_7d_min":      "Mín 7 días",
+		"lbl_7d_max":      "Máx 7 días",
+		"weekly_digest":   "Informe semanal de staking",
+		"monthly_digest":  "Informe mensual de staking",
+		"lbl_from":        "Desde",
+		"lbl_to":          "Hasta",
+		"lbl_actual_avg":  "Tasa media",
+		"lbl_actual_min":  "Tasa mín",
+		"lbl_actual_max":  "Tasa máx",
+		"lbl_actual_rate": "Tasa real",
+		"lbl_blocks":      "Bloques",
+		"lbl_staking_chg": "Cambio staking",
+		"lbl_alerts":      "Alertas",
+
+		"wd_prefix":            "Particld watchdog: %s",
+		"wd_normal":            "funcionamiento normal",
+		"wd_comm_failed":       "falló la comunicación con particld.",
+		"wd_not_staking":       "particld no está haciendo staking, causa: %s",
+		"wd_mail_subject":      "Alerta del Particld Watchdog",
+		"wd_wallet_not_loaded": "la billetera de staking %s no está cargada.",
+		"wd_wallet_locked":     "la billetera de staking está bloqueada",
+		"wd_no_weight":         "no hay saldo disponible para staking en la billetera de staking",
+		"wd_weight_drop":       "el peso de staking bajó un %s %% de %s a %s.",
+		"delegation_change":    "Cambio de delegación: %s %s, total delegado: %s",
+		"wd_pool_prefix":       "Stake pool watchdog: %s",
+		"wd_pool_down":         "el servidor del stake pool no está accesible.",
+		"wd_pool_timeout":      "el servidor del stake pool no responde.",
+		"wd_pool_slow":         "el tiempo de respuesta del servidor del stake pool de %s s supera %d s.",
+		"wd_pool_behind":       "el stake pool está %d bloques detrás del nodo (pool: %d, nodo: %d).",
+
+		"cmd_calc":          "Proyectar recompensas de staking",
+		"arg_calc":          "<cantidad PART> [<días>] [<comisión del pool %>]",
+		"calc_usage":        "Uso: /calc <cantidad PART> [<días>] [<comisión del pool %>]",
+		"calc_invalid_days": "El número de días \"%s\" no es válido, use 1 a %d.",
+		"calc_invalid_fee":  "La comisión del pool \"%s\" no es válida, use 0 a 99 %%.",
+		"calc_title":        "Proyección de recompensas para %s en %d días",
+		"calc_fee":          "Comisión del pool: %s %%",
+		"calc_history":      "Rango basado en %d días de historial de la tasa de interés real.",
+		"calc_nominal":      "Nominal",
+		"calc_actual":       "Real",
+		"calc_history_min":  "Historial mín",
+		"calc_history_avg":  "Historial prom",
+		"calc_history_max":  "Historial máx",
+		"col_rate":          "Tasa %",
+		"col_reward":        "Recompensa",
+		"col_compound":      "Compuesta",
+
+		"cmd_poolinfo":         "Consultar estadísticas del pool de staking",
+		"pool_info":            "Información del pool de staking",
+		"pool_no_data":         "No hay estadísticas del pool de staking disponibles.",
+		"pool_stale":           "El servidor del pool de staking no está accesible, las estadísticas pueden estar desactualizadas.",
+		"lbl_updated":          "Actualizado",
+		"lbl_pool_height":      "Altura del pool",
+		"lbl_balance":          "Saldo",
+		"lbl_accounts":         "Cuentas",
+		"lbl_blocks_found":     "Bloques encontrados",
+		"lbl_last_block_found": "Último encontrado",
+		"lbl_pending_payouts":  "Pagos pendientes",
+
+		"cmd_blocks":     "Consultar bloques del pool y suerte",
+		"pool_luck":      "Suerte del pool",
+		"pool_blocks":    "Últimos bloques del pool",
+		"no_pool_blocks": "No hay bloques del pool registrados.",
+		"col_days":       "Días",
+		"col_found":      "Enc.",
+		"col_expected":   "Esperado",
+		"col_luck":       "Suerte",
+	},
+}
+
+var g_tgChatLanguages = make(map[int64]string)
+var g_tgChatLanguagesMutex sync.Mutex
+
+// tr returns the catalog message <key> for given language formatted with <args>
+func tr(lang, key string, args ...interface{}) string {
+	msg, ok := g_messages[lang][key]
+	if !ok {
+		msg, ok = g_messages[defaultLanguage][key]
+		if !ok {
+			fmt.Printf("tr: missing message \"%s\"\n", key)
+			msg = key
+		}
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+func languageSupported(lang string) bool {
+	_, ok := g_messages[lang]
+	return ok
+}
+
+func languageList() []string {
+	var res []string
+	for l := range g_messages {
+		res = append(res, l)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// language used for watchdog messages and emails
+func watchdogLanguage() string {
+	if languageSupported(g_config.Language) {
+		return g_config.Language
+	}
+	return defaultLanguage
+}
+
+// formats a number with given decimals using the digit grouping and decimal separator of given language
+func formatNumber(lang string, v float64, decimals int) string {
+	nf, ok := g_numberFormats[lang]
+	if !ok {
+		nf = g_numberFormats[defaultLanguage]
+	}
+
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	intPart, fracPart := s, ""
+	if n := strings.Index(s, "."); n >= 0 {
+		intPart, fracPart = s[:n], s[n+1:]
+	}
+
+	var sb strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		sb.WriteString("-")
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteString(nf.Thousands)
+		}
+		sb.WriteRune(c)
+	}
+	if fracPart != "" {
+		sb.WriteString(nf.Decimal)
+		sb.WriteString(fracPart)
+	}
+
+	return sb.String()
+}
+
+func formatPart(lang string, v float64, decimals int) string {
+	return formatNumber(lang, v, decimals) + " PART"
+}
+
+// parses a user supplied amount in the number format of <lang>. A comma is accepted as decimal separator only for
+// languages using a decimal comma, input that could be read with either separator as thousands separator (e.g.
+// "1,000" for English or "1.000" for German) is rejected as ambiguous.
+func parseAmount(lang, s string) (float64, error) {
+	nf, ok := g_numberFormats[lang]
+	if !ok {
+		nf = g_numberFormats[defaultLanguage]
+	}
+
+	if nf.Decimal == "," {
+		if strings.Contains(s, ",") && strings.Contains(s, ".") {
+			return 0, fmt.Errorf("ambiguous amount: %s", s)
+		}
+		if n := strings.LastIndex(s, "."); n >= 0 && len(s)-n-1 == 3 {
+			return 0, fmt.Errorf("ambiguous amount: %s", s)
+		}
+		s = strings.Replace(s, ",", ".", 1)
+	} else if strings.Contains(s, ",") {
+		return 0, fmt.Errorf("ambiguous amount: %s", s)
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("invalid amount: %s", s)
+	}
+
+	return v, nil
+}
+
+// formats label/value pairs as fixed width table with aligned values
+func infoTable(rows [][2]string) string {
+	width := 0
+	for _, r := range rows {
+		if n := utf8.RuneCountInString(r[0]); n > width {
+			width = n
+		}
+	}
+
+	txt := ""
+	for _, r := range rows {
+		txt += " " + r[0] + strings.Repeat(" ", width-utf8.RuneCountInString(r[0])) + ": " + r[1] + "\n"
+	}
+
+	return txt
+}
+
+// language of given chat: language set with /language, configured default language or English
+func telegramChatLanguage(chatId int64) string {
+	g_tgChatLanguagesMutex.Lock()
+	lang, ok := g_tgChatLanguages[chatId]
+	g_tgChatLanguagesMutex.Unlock()
+
+	if ok && languageSupported(lang) {
+		return lang
+	}
+
+	if languageSupported(g_tgConfig.DefaultLanguage) {
+		return g_tgConfig.DefaultLanguage
+	}
+
+	return defaultLanguage
+}
+
+func telegramLoadChatLanguages() {
+	if g_tgConfig.LanguageFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(g_tgConfig.LanguageFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("TG: failed to read language file: %v\n", err)
+		}
+		return
+	}
+
+	g_tgChatLanguagesMutex.Lock()
+	err = json.Unmarshal(data, &g_tgChatLanguages)
+	g_tgChatLanguagesMutex.Unlock()
+
+	if err != nil {
+		fmt.Printf("TG: syntax error in language file %s: %v\n", g_tgConfig.LanguageFile, err)
+	}
+}
+
+func telegramSetChatLanguage(chatId int64, lang string) {
+	g_tgChatLanguagesMutex.Lock()
+	g_tgChatLanguages[chatId] = lang
+	data, err := json.Marshal(g_tgChatLanguages)
+	g_tgChatLanguagesMutex.Unlock()
+
+	if g_tgConfig.LanguageFile == "" {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("TG: language file Marshal: %v\n", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(g_tgConfig.LanguageFile, data, 0600); err != nil {
+		fmt.Printf("TG: failed to write language file: %v\n", err)
+	}
+}
+
+func telegramCmdLanguage(chatId int64, args []string) {
+	lang := telegramChatLanguage(chatId)
+
+	var available []string
+	for _, l := range languageList() {
+		available = append(available, l+" ("+g_languageNames[l]+")")
+	}
+
+	if len(args) < 1 {
+		telegramSendMessage(chatId, tr(lang, "language_current", g_languageNames[lang],
+			strings.Join(available, ", ")))
+		return
+	}
+
+	newLang := strings.ToLower(args[0])
+	if !languageSupported(newLang) {
+		telegramSendMessage(chatId, tr(lang, "language_invalid", args[0], strings.Join(available, ", ")))
+		return
+	}
+
+	telegramSetChatLanguage(chatId, newLang)
+	telegramSendMessage(chatId, tr(newLang, "language_set", g_languageNames[newLang]))
+}
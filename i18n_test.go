@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		lang string
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"en", "1000", 1000, true},
+		{"en", "1.5", 1.5, true},
+		{"en", "1,000", 0, false},
+		{"en", "1,5", 0, false},
+		{"de", "1,000", 1, true},
+		{"de", "1,5", 1.5, true},
+		{"de", "1.5", 1.5, true},
+		{"de", "1.000", 0, false},
+		{"de", "1.000,5", 0, false},
+		{"es", "2,25", 2.25, true},
+		{"en", "Inf", 0, false},
+		{"en", "NaN", 0, false},
+	}
+
+	for _, tc := range tests {
+		v, err := parseAmount(tc.lang, tc.in)
+		if tc.ok && (err != nil || v != tc.want) {
+			t.Errorf("parseAmount(%s, %q): got %v, %v, want %v", tc.lang, tc.in, v, err, tc.want)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("parseAmount(%s, %q): got %v, want error", tc.lang, tc.in, v)
+		}
+	}
+}
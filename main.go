@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-gomail/gomail"
 	_ "github.com/lib/pq"
@@ -32,13 +34,25 @@ type ParticldStatus struct {
 	NominalRate       float64 `json:"nominal_rate"`
 	ActualRate        float64 `json:"actual_rate"`
 	SmsgFeeRateTarget float64 `json:"smsg_fee_rate_target"`
+	ActualRate7d      float64 `json:"actual_rate_7d"`
+	ActualRate30d     float64 `json:"actual_rate_30d"`
+	RateMethod        string  `json:"rate_method"`
+	RateWindow        int64   `json:"rate_window"`
+	WeightSat         int64   `json:"-"`
+	NetWeightSat      int64   `json:"-"`
+}
+
+type TGResponseParameters struct {
+	Migrate_to_chat_id int64 `json:"migrate_to_chat_id"`
+	Retry_after        int   `json:"retry_after"`
 }
 
 type TGQueryResult struct {
-	Ok          bool        `json:"ok"`
-	Error_code  int         `json:"error_code"`
-	Description string      `json:"description"`
-	Result      interface{} `json:"result"`
+	Ok          bool                 `json:"ok"`
+	Error_code  int                  `json:"error_code"`
+	Description string               `json:"description"`
+	Parameters  TGResponseParameters `json:"parameters"`
+	Result      interface{}          `json:"result"`
 }
 
 type TGGetUpdate struct {
@@ -53,9 +67,11 @@ type TGGetChat struct {
 type TGSendMessage struct {
 	Chat_id                  int64  `json:"chat_id"`
 	Text                     string `json:"text"`
-	Parse_mode               string `json:"parse_mode"`
+	Parse_mode               string `json:"parse_mode,omitempty"`
 	Disable_web_page_preview bool   `json:"disable_web_page_preview"`
 	Disable_notification     bool   `json:"disable_notification"`
+
+	Reply_markup *TGInlineKeyboardMarkup `json:"reply_markup,omitempty"`
 }
 
 type TGUser struct {
@@ -95,10 +111,18 @@ type TGMessage struct {
 	Left_chat_member TGUser            `json:"left_chat_member"`
 }
 
+type TGCallbackQuery struct {
+	Id      string    `json:"id"`
+	From    TGUser    `json:"from"`
+	Message TGMessage `json:"message"`
+	Data    string    `json:"data"`
+}
+
 type TGUpdate struct {
-	Update_id      int       `json:"update_id"`
-	Message        TGMessage `json:"message"`
-	Edited_message TGMessage `json:"edited_message"`
+	Update_id      int             `json:"update_id"`
+	Message        TGMessage       `json:"message"`
+	Edited_message TGMessage       `json:"edited_message"`
+	Callback_query TGCallbackQuery `json:"callback_query"`
 }
 
 type PoolAccountInfo struct {
@@ -111,19 +135,38 @@ type PoolAccountInfo struct {
 }
 
 type Config struct {
-	Port                  int
-	ParticldRpcPort       int
-	ParticldDataDir       string
-	ParticldStakingWallet string
-	ParticldStakingCtlKey string
-	StakePoolUrl          string
-	StakePoolRewardAdr    string
-	ZmqEndpoint           string
-	DbUrl                 string
-	WatchdogEmailTo       string
-	WatchdogEmailFrom     string
-	WatchdogEmailSubject  string
-	Smsgfeeratetarget     float64
+	Port                     int
+	ParticldRpcPort          int
+	ParticldDataDir          string
+	ParticldStakingWallet    string
+	ParticldStakingCtlKey    string
+	StakePoolUrl             string
+	StakePoolRewardAdr       string
+	StakePoolTimeout         int
+	StakePoolCacheTtl        int
+	PoolStatsInterval        int
+	PoolWatchdogDisabled     bool
+	PoolWatchdogMaxLatency   int
+	PoolWatchdogMaxBlockLag  int
+	ColdStakingAddress       string
+	DelegationAlertThreshold int
+	ApiKey                   string
+	WalletWeightDropPercent  int
+	RateEstimator            string
+	RateEstimatorWindow      int
+	RateHistoryFile          string
+	NodeStatsFile            string
+	EventsMaxSubscribers     int
+	ZmqEndpoint              string
+	DbUrl                    string
+	WatchdogEmailTo          string
+	WatchdogEmailFrom        string
+	WatchdogEmailSubject     string
+	Smsgfeeratetarget        float64
+	DigestEmailTo            string
+	DigestEmailFrom          string
+	DigestEmailPeriods       []string
+	Language                 string
 }
 
 type TGConfig struct {
@@ -133,13 +176,26 @@ type TGConfig struct {
 	StatusMsgMinute     int
 	StatusMsgChatName   string
 	WatchdogMsgChatName string
+	AdminUserIds        []int
+	ParseMode           string
+	OutboxFile          string
+	OutboxMaxEntries    int
+	Schedules           []TGSchedule
+	ScheduleStateFile   string
+	DefaultLanguage     string
+	LanguageFile        string
 }
 
 type StakingRateHistory struct {
-	Timestamp int64
-	AvgRate   float64
-	MinRate   float64
-	MaxRate   float64
+	Timestamp int64   `json:"time"`
+	AvgRate   float64 `json:"avg"`
+	MinRate   float64 `json:"min"`
+	MaxRate   float64 `json:"max"`
+	P10       float64 `json:"p10"`
+	P50       float64 `json:"p50"`
+	P90       float64 `json:"p90"`
+	StdDev    float64 `json:"stddev"`
+	Blocks    int     `json:"blocks"`
 }
 
 type Sat int64
@@ -155,6 +211,7 @@ var g_config = Config{Port: 0, ParticldRpcPort: 51735, ZmqEndpoint: "tcp://127.0
 var g_httpServer *http.Server
 var g_tgConfig TGConfig
 var g_TGBotEnabled = false
+var g_tgApiUrl = "https://api.telegram.org"
 
 var g_stakingRateHistoryHourly []StakingRateHistory
 var g_stakingRateHistoryDaily []StakingRateHistory
@@ -227,57 +284,6 @@ func dbConnect() *sql.DB {
 	return db
 }
 
-// retieve JSON data from stakepool
-func spCall(cmd string, res interface{}) bool {
-
-	url := strings.TrimRight(g_config.StakePoolUrl, "/") + "/" + cmd
-
-	resp, err := http.Get(url)
-
-	if err != nil {
-		fmt.Printf("stakepoolCall: Error: Get: %v", err)
-		return false
-	}
-
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("stakepoolCall: Error: ReadAll: %v", err)
-		return false
-	}
-
-	//fmt.Println(string(body))
-	//fmt.Println(resp.Status)
-
-	if resp.StatusCode != 200 {
-		fmt.Printf("stakepoolCall: Bad response status: %s", resp.Status)
-		return false
-	}
-
-	err = json.Unmarshal(body, &res)
-	if err != nil {
-		fmt.Printf("stakepoolCall: Unmarshal: %v", err)
-		return false
-	}
-
-	return true
-}
-
-func spAccountInfo(account string, res *PoolAccountInfo) bool {
-	cmd := "json/address/" + account
-	return spCall(cmd, res)
-}
-
-func spConvertSatToString8(sat int64) string {
-	val := float64(sat)
-	return fmt.Sprintf("%.2f PART", val/SatPerPart)
-}
-
-func spConvertSatToString16(sat int64) string {
-	val := float64(sat)
-	return fmt.Sprintf("%.2f PART", val/SatPerPart/SatPerPart)
-}
-
 func particldStatusCollector() {
 	statusError := "communication error"
 	na := "n/a"
@@ -286,16 +292,21 @@ func particldStatusCollector() {
 	prpc.SetRpcPort(g_config.ParticldRpcPort)
 	prpc.SetDataDirectoy(g_config.ParticldDataDir)
 
+	var published ParticldStatus
+
 	for {
 
 		status := ParticldStatus{Status:"", Version:na, Peers:na, LastBlock:na, Weight:na, NetWeight:na, Uptime:na}
+		var sample NodeStatsSample
 
 		if err := prpc.ReadPartRpcCookie(); err == nil {
 
 			nwinfo, err := prpc.GetNetworkInfo()
+			peersOk := err == nil
 			if err == nil {
 				status.Version = nwinfo.Subversion
 				status.Peers = fmt.Sprintf("%d", nwinfo.Connections)
+				sample.Peers = nwinfo.Connections
 			} else {
 				fmt.Println(err)
 				status.Status = statusError
@@ -313,6 +324,15 @@ func particldStatusCollector() {
 			if err == nil {
 				status.Weight = fmt.Sprintf("%d PART", stakeinfo.Weight/SatPerPart)
 				status.NetWeight = fmt.Sprintf("%dK PART", stakeinfo.Netstakeweight/SatPerPart/1000)
+				status.WeightSat = stakeinfo.Weight
+				status.NetWeightSat = stakeinfo.Netstakeweight
+
+				sample.Weight = stakeinfo.Weight
+				sample.NetWeight = stakeinfo.Netstakeweight
+				sample.MoneySupply = stakeinfo.Moneysupply
+				// network weight, money supply and peers are recorded together, a sample without peers is incomplete
+				sample.Network = peersOk
+				nodeStatsRecord(sample)
 
 				if g_db == nil {
 					// no db, calculate staking rate from stakeinfo
@@ -363,14 +383,22 @@ func particldStatusCollector() {
 		g_particldStatus.Weight = status.Weight
 		g_particldStatus.NetWeight = status.NetWeight
 		g_particldStatus.SmsgFeeRateTarget = status.SmsgFeeRateTarget
+		g_particldStatus.WeightSat = status.WeightSat
+		g_particldStatus.NetWeightSat = status.NetWeightSat
+		current := g_particldStatus
 
 		g_particldStatusMutex.Unlock()
 
+		if current != published {
+			published = current
+			eventsPublish("status", current)
+		}
+
 		time.Sleep(60 * time.Second)
 	}
 }
 
-var g_avgActualReward = float64(0)
+var g_rateEstimator *rateEstimator
 
 func calcStakingReward(stakeinfo *particlrpc.StakingInfo) {
 	/*
@@ -392,45 +420,49 @@ func calcStakingReward(stakeinfo *particlrpc.StakingInfo) {
 	actualReward /= float64(stakeinfo.Netstakeweight) / SatPerPart
 	actualReward *= 100
 
-	if g_avgActualReward != 0 {
-		g_avgActualReward = 0.99*g_avgActualReward + 0.01*actualReward
-	} else {
-		g_avgActualReward = actualReward
+	if g_rateEstimator == nil {
+		g_rateEstimator = newRateEstimatorFromConfig()
 	}
+	g_rateEstimator.Add(time.Now().Unix(), actualReward)
+	rateBufferAdd(time.Now().Unix(), actualReward)
 
 	g_particldStatusMutex.Lock()
 	g_particldStatus.NominalRate = nominalReward
-	g_particldStatus.ActualRate = g_avgActualReward
+	g_particldStatus.ActualRate = g_rateEstimator.Rate()
+	g_particldStatus.RateMethod = g_rateEstimator.Method
+	g_particldStatus.RateWindow = g_rateEstimator.Window
 	g_particldStatusMutex.Unlock()
-
-	//fmt.Printf("Actual avg reward: %.8f\n", g_avgActualReward)
 }
 
 func stakingRewardCollector() {
-	avgCnt := 100
+	estimator := newRateEstimatorFromConfig()
+	lastBlockNr := int64(-1)
+	var nominalRate float64
+
 	for {
-		var nominalRate float64
-		var avgActualRate float64
+		var rows *sql.Rows
+		var err error
 
-		rows, err := g_db.Query("SELECT block_nr,block_time,nominal_rate,actual_rate FROM stakingratestats ORDER BY block_nr DESC LIMIT $1", avgCnt)
+		if lastBlockNr < 0 {
+			rows, err = g_db.Query("SELECT block_nr,block_time,nominal_rate,actual_rate FROM stakingratestats WHERE block_time >= (SELECT max(block_time) FROM stakingratestats) - $1 ORDER BY block_nr",
+				estimator.historyLength())
+		} else {
+			rows, err = g_db.Query("SELECT block_nr,block_time,nominal_rate,actual_rate FROM stakingratestats WHERE block_nr > $1 ORDER BY block_nr",
+				lastBlockNr)
+		}
 
 		if err == nil {
-			n := 0
-			avgActualRate = 0
-
 			for cont := rows.Next(); cont; cont = rows.Next() {
-				var blockNr int
+				var blockNr int64
 				var blockTime int64
 				var actualRate float64
 				var nom float64
 
 				err = rows.Scan(&blockNr, &blockTime, &nom, &actualRate)
 				if err == nil {
-					if nominalRate == 0 {
-						nominalRate = nom
-					}
-					avgActualRate += actualRate
-					n++
+					nominalRate = nom
+					estimator.Add(blockTime, actualRate)
+					lastBlockNr = blockNr
 				} else {
 					fmt.Printf("db scan failed: %v\n", err)
 				}
@@ -444,17 +476,15 @@ func stakingRewardCollector() {
 			if err != nil {
 				fmt.Printf("db close rows failed: %v\n", err)
 			}
-
-			if n > 0 {
-				avgActualRate /= float64(n)
-			}
 		} else {
 			fmt.Printf("db query failed: %v\n", err)
 		}
 
 		g_particldStatusMutex.Lock()
 		g_particldStatus.NominalRate = nominalRate
-		g_particldStatus.ActualRate = avgActualRate
+		g_particldStatus.ActualRate = estimator.Rate()
+		g_particldStatus.RateMethod = estimator.Method
+		g_particldStatus.RateWindow = estimator.Window
 		g_particldStatusMutex.Unlock()
 
 		time.Sleep(60 * time.Second)
@@ -502,7 +532,10 @@ func stakingRewardCollector() {
 }
 
 func getStakingRateHistory(interval int64, cnt int) []StakingRateHistory {
-	rows, err := g_db.Query("select block_time/$1 as x, sum(actual_rate)/count(actual_rate), min(actual_rate), max(actual_rate) from stakingratestats  group by x order by x desc limit $2",
+	rows, err := g_db.Query("select block_time/$1 as x, sum(actual_rate)/count(actual_rate), min(actual_rate), max(actual_rate), "+
+		"percentile_cont(0.1) within group (order by actual_rate), percentile_cont(0.5) within group (order by actual_rate), "+
+		"percentile_cont(0.9) within group (order by actual_rate), stddev_pop(actual_rate), count(actual_rate) "+
+		"from stakingratestats group by x order by x desc limit $2",
 		interval, cnt)
 
 	if err != nil {
@@ -516,14 +549,15 @@ func getStakingRateHistory(interval int64, cnt int) []StakingRateHistory {
 	i := 0
 	for cont := rows.Next(); cont; cont = rows.Next() {
 		var timestamp int64
-		var avgRate, minRate, maxRate float64
+		var avgRate, minRate, maxRate, p10, p50, p90, stdDev float64
+		var blocks int
 
-		err = rows.Scan(&timestamp, &avgRate, &minRate, &maxRate)
+		err = rows.Scan(&timestamp, &avgRate, &minRate, &maxRate, &p10, &p50, &p90, &stdDev, &blocks)
 
 		if err == nil {
 			if i < cnt {
 				res = append(res, StakingRateHistory{timestamp * interval, round(avgRate),
-					round(minRate), round(maxRate)})
+					round(minRate), round(maxRate), round(p10), round(p50), round(p90), round(stdDev), blocks})
 				i++
 			}
 		} else {
@@ -544,18 +578,34 @@ func getStakingRateHistory(interval int64, cnt int) []StakingRateHistory {
 	return res
 }
 
+// updates the staking rate history from the database or, if no database is configured, from the rate ring buffer
 func stakingRateHistoryCollector() {
 	var lastUpdate time.Time
+	var lastSave time.Time
 
 	for {
 		if time.Since(lastUpdate) > 10*60*time.Second {
 			//fmt.Printf("Updating staking rate history.\n")
 			lastUpdate = time.Now()
 
-			histHourly := getStakingRateHistory(60*60, 24)
-			histDaily := getStakingRateHistory(24*60*60, 30)
+			var histHourly, histDaily []StakingRateHistory
+			var rate7d, rate30d float64
+
+			if g_db != nil {
+				histHourly = getStakingRateHistory(60*60, 24)
+				histDaily = getStakingRateHistory(24*60*60, 30)
+				rate7d = getStakingRateRolling(7)
+				rate30d = getStakingRateRolling(30)
+			} else {
+				histHourly = rateBufferHistory(time.UTC, false, 24)
+				histDaily = rateBufferHistory(time.UTC, true, 30)
+				rate7d = rateBufferRolling(7)
+				rate30d = rateBufferRolling(30)
+			}
 
 			g_particldStatusMutex.Lock()
+			g_particldStatus.ActualRate7d = rate7d
+			g_particldStatus.ActualRate30d = rate30d
 			g_stakingRateHistoryHourly = make([]StakingRateHistory, len(histHourly))
 			g_stakingRateHistoryDaily = make([]StakingRateHistory, len(histDaily))
 			copy(g_stakingRateHistoryHourly, histHourly)
@@ -563,115 +613,220 @@ func stakingRateHistoryCollector() {
 			g_particldStatusMutex.Unlock()
 		}
 
+		if g_db == nil && time.Since(lastSave) > rateBufferSaveInterval {
+			if !lastSave.IsZero() {
+				rateBufferSave()
+			}
+			lastSave = time.Now()
+		}
+
 		time.Sleep(time.Second)
 	}
 
 }
 
 func telegramCall(in, out interface{}, request string, timeout time.Duration) bool {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", g_tgConfig.BotAuth, request)
-
-	client := &http.Client{
-		Timeout: timeout,
-	}
-
 	data, err := json.Marshal(in)
 	if err != nil {
 		fmt.Printf("telegramCall: Marshal: %v\n", err)
 		return false
 	}
 
-	resp, err := client.Post(url, "application/json", strings.NewReader(string(data)))
+	return telegramRequest(request, "application/json", bytes.NewReader(data), out, timeout) == nil
+}
+
+// performs a POST request to the bot API with given content type and body, decodes result to <out>
+func telegramRequest(request, contentType string, body io.Reader, out interface{}, timeout time.Duration) *tgCallError {
+	url := fmt.Sprintf("%s/bot%s/%s", g_tgApiUrl, g_tgConfig.BotAuth, request)
+
+	client := &http.Client{
+		Timeout: timeout,
+	}
+
+	resp, err := client.Post(url, contentType, body)
 	if err != nil {
 		fmt.Printf("telegramCall: Post: %v\n", err)
-		return false
+		return &tgCallError{Description: err.Error()}
 	}
 	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		fmt.Printf("telegramCall: ReadAll: %v\n", err)
-		return false
+		return &tgCallError{StatusCode: resp.StatusCode, Description: err.Error()}
 	}
 
-	//fmt.Println(string(body))
+	//fmt.Println(string(respBody))
 	//fmt.Println(resp.Status)
 
-	if resp.StatusCode != 200 {
-		fmt.Printf("telegramCall: Bad response status: %s\n", resp.Status)
-		return false
-	}
-
 	var result TGQueryResult
 
 	result.Result = out
 
-	err = json.Unmarshal(body, &result)
+	err = json.Unmarshal(respBody, &result)
+
+	if resp.StatusCode != 200 {
+		fmt.Printf("telegramCall: Bad response status: %s: %s\n", resp.Status, result.Description)
+		return &tgCallError{resp.StatusCode, result.Description, result.Parameters.Retry_after}
+	}
+
 	if err != nil {
-		fmt.Printf("telegramCall: Unmarshal: %v", err)
-		return false
+		fmt.Printf("telegramCall: Unmarshal: %v\n", err)
+		return &tgCallError{StatusCode: resp.StatusCode, Description: err.Error()}
 	}
 
 	if !result.Ok {
 		fmt.Printf("telegramCall: query failed: %s\n", result.Description)
-		return false
+		return &tgCallError{result.Error_code, result.Description, result.Parameters.Retry_after}
 	}
 
-	return true
+	return nil
 }
 
+// sends a plain text message without any formatting
 func telegramSendMessage(chatId int64, msg string) bool {
+	return telegramSendFormatted(chatId, newTgMsg().Text(msg))
+}
+
+func telegramTextRequest(chatId int64, text, parseMode string, keyboard *TGInlineKeyboardMarkup) json.RawMessage {
 	var req TGSendMessage
 
 	req.Chat_id = chatId
-	req.Text = msg
-	req.Parse_mode = "Markdown"
+	req.Text = text
+	req.Parse_mode = parseMode
 	req.Disable_notification = true
 	req.Disable_web_page_preview = false
+	req.Reply_markup = keyboard
 
-	var res TGMessage
-	if !telegramCall(req, &res, "sendMessage", 10*time.Second) {
-		n := 20
-		if len(msg) < n {
-			n = len(msg)
+	data, err := json.Marshal(req)
+	if err != nil {
+		fmt.Printf("telegramTextRequest: Marshal: %v\n", err)
+	}
+
+	return data
+}
+
+// queues a formatted message using the configured parse mode, messages exceeding the Telegram length
+// limit are split, each part is resent as plain text if sending the formatted part is rejected
+// an optional inline keyboard is attached to the last part
+func telegramQueueFormatted(chatId int64, msg *tgMsg, keyboard *TGInlineKeyboardMarkup, persist bool) []chan bool {
+	mode := telegramParseMode()
+	var res []chan bool
+
+	parts := msg.Split(mode, tgMaxMessageLength)
+
+	for i, m := range parts {
+		var kb *TGInlineKeyboardMarkup
+		if i == len(parts)-1 {
+			kb = keyboard
 		}
-		fmt.Printf("telegramSendMessage: failed: chat_id: %d, msg: \"%s\"\n", chatId, msg[:n])
-		return false
+
+		item := &tgOutMsg{ChatId: chatId, Method: "sendMessage", Persist: persist,
+			Request:  telegramTextRequest(chatId, m.Render(mode), mode, kb),
+			Fallback: telegramTextRequest(chatId, m.Plain(), "", kb)}
+		res = append(res, telegramEnqueue(item))
 	}
 
-	return true
+	return res
 }
 
-func telegramCmdStatus(chatId int64) bool {
+// sends a formatted message and waits until it is delivered or dropped
+func telegramSendFormatted(chatId int64, msg *tgMsg) bool {
+	return telegramWaitAll(telegramQueueFormatted(chatId, msg, nil, false))
+}
+
+// sends a formatted message with inline keyboard
+func telegramSendKeyboard(chatId int64, msg *tgMsg, keyboard *TGInlineKeyboardMarkup) bool {
+	return telegramWaitAll(telegramQueueFormatted(chatId, msg, keyboard, false))
+}
+
+// queues an alert message, alerts are kept in the outbox until delivered and do not block the caller
+func telegramSendAlert(chatId int64, msg *tgMsg) {
+	telegramQueueFormatted(chatId, msg, nil, true)
+}
+
+// sends a PNG photo with formatted caption, caption is resent as plain text if formatted sending fails
+func telegramSendPhoto(chatId int64, photo []byte, caption *tgMsg) bool {
+	mode := telegramParseMode()
+
+	text := caption.Render(mode)
+	if tgLength(text) > tgMaxCaptionLength {
+		text = ""
+		if parts := caption.Split(mode, tgMaxCaptionLength); len(parts) > 0 {
+			text = parts[0].Render(mode)
+		}
+	}
+
+	plain := caption.Plain()
+	if tgLength(plain) > tgMaxCaptionLength {
+		plain = ""
+	}
+
+	photoRequest := func(caption, parseMode string) json.RawMessage {
+		data, _ := json.Marshal(map[string]string{"chat_id": strconv.FormatInt(chatId, 10), "caption": caption,
+			"parse_mode": parseMode, "disable_notification": "true"})
+		return data
+	}
+
+	item := &tgOutMsg{ChatId: chatId, Method: "sendPhoto", Photo: photo,
+		Request: photoRequest(text, mode), Fallback: photoRequest(plain, "")}
+
+	return telegramWaitAll([]chan bool{telegramEnqueue(item)})
+}
+
+// translates the node status as set by particldStatusCollector
+func telegramStatusText(lang, status string) string {
+	switch {
+	case status == "Staking":
+		return tr(lang, "status_staking")
+	case status == "communication error":
+		return tr(lang, "status_comm_error")
+	case strings.HasPrefix(status, "Not Staking: "):
+		return tr(lang, "status_not_staking", strings.TrimPrefix(status, "Not Staking: "))
+	}
+	return status
+}
+
+func telegramStatusMsg(lang string) *tgMsg {
 	var status ParticldStatus
 
 	g_particldStatusMutex.Lock()
 	status = g_particldStatus
 	g_particldStatusMutex.Unlock()
 
-	msg := "*Particl Node Info*\n"
-	msg += "```"
-	msg += fmt.Sprintf(" Timestamp  : %s\n", time.Now().UTC().Format(time.RFC3339))
-	msg += fmt.Sprintf(" Status     : %s\n", status.Status)
-	msg += fmt.Sprintf(" Version    : %s\n", status.Version)
-	msg += fmt.Sprintf(" Uptime     : %s\n", status.Uptime)
-	msg += fmt.Sprintf(" Peers      : %s\n", status.Peers)
-	msg += fmt.Sprintf(" Last Block : %s\n", status.LastBlock)
-	msg += fmt.Sprintf(" Staking    : %s\n", status.Weight)
-	msg += fmt.Sprintf(" NetStaking : %s\n", status.NetWeight)
-	msg += fmt.Sprintf(" MP Fee Vote: %f PART\n", status.SmsgFeeRateTarget)
-	msg += "```"
-
-	return telegramSendMessage(chatId, msg)
+	rows := [][2]string{
+		{tr(lang, "lbl_timestamp"), time.Now().UTC().Format(time.RFC3339)},
+		{tr(lang, "lbl_status"), telegramStatusText(lang, status.Status)},
+		{tr(lang, "lbl_version"), status.Version},
+		{tr(lang, "lbl_uptime"), status.Uptime},
+		{tr(lang, "lbl_peers"), status.Peers},
+		{tr(lang, "lbl_last_block"), status.LastBlock},
+		{tr(lang, "lbl_staking"), status.Weight},
+		{tr(lang, "lbl_net_staking"), status.NetWeight},
+		{tr(lang, "lbl_mp_fee_vote"), formatPart(lang, status.SmsgFeeRateTarget, 6)},
+	}
+
+	if d := delegationStatsCopy(); d.Updated != 0 {
+		rows = append(rows, [2]string{tr(lang, "lbl_delegators"), formatNumber(lang, float64(d.Delegators), 0)},
+			[2]string{tr(lang, "lbl_cs_utxos"), formatNumber(lang, float64(d.Utxos), 0)},
+			[2]string{tr(lang, "lbl_delegated"), formatPart(lang, d.TotalWeight, 0)})
+	}
+
+	info := infoTable(rows)
+
+	return newTgMsg().Bold(tr(lang, "node_info")).Text("\n").Pre(info)
+}
+
+func telegramCmdStatus(chatId int64) bool {
+	lang := telegramChatLanguage(chatId)
+	return telegramSendKeyboard(chatId, telegramStatusMsg(lang), telegramStatusKeyboard(lang))
 }
 
-func telegramCmdStart(chatId int64, user string) bool {
-	msg := fmt.Sprintf("Hello %s!\n\n", user)
-	msg += "This bot is intended to monitor and query the Crymel Particl Cold Staking Pool: https://particl.crymel.icu\n"
-	msg += "\n*Commands:*\n"
-	msg += "/status - Get Particl node status\n"
-	msg += "/accountinfo <account id> - Get account balance in staking pool\n"
-	msg += "/stakeinfo [<amount PART>] - Get staking interest rate info"
-	return telegramSendMessage(chatId, msg)
+func telegramCmdStart(chatId int64, from TGUser) bool {
+	lang := telegramChatLanguage(chatId)
+	msg := newTgMsg().Text(tr(lang, "hello", from.First_name) + "\n\n")
+	msg.Text(tr(lang, "intro") + "\n")
+	msg.Text("\n").Append(telegramHelpText(lang, telegramIsAdmin(from)))
+	return telegramSendFormatted(chatId, msg)
 }
 
 func telegramGetChat(chatName string) (bool, int64) {
@@ -686,74 +841,165 @@ func telegramGetChat(chatName string) (bool, int64) {
 }
 
 func telegramCmdAccountInfo(chatId int64, args []string) {
+	lang := telegramChatLanguage(chatId)
 
 	if len(args) < 1 {
-		telegramSendMessage(chatId, "Missing account ID argument.")
+		telegramSendMessage(chatId, tr(lang, "missing_account"))
 		return
 	}
 
 	account := args[0]
 
-	var info PoolAccountInfo
-	msg := ""
-
-	if spAccountInfo(account, &info) {
-		if info.Error == "Invalid address" {
-			msg = "Account ID `" + account + "` is not valid."
-		} else {
-			msg = "Staking pool account info for `" + account + "`:\n" +
-				"total rewards: " + spConvertSatToString16(info.Accumulated) +
-				", confirmed payout: " + spConvertSatToString8(info.Rewardpaidout) +
-				", unconfirmed payout: " + spConvertSatToString8(info.Rewardpending) +
-				", open payout: " + spConvertSatToString8(info.Accumulated/SatPerPart-info.Rewardpaidout-info.Rewardpending) +
-				", last staking weight: " + spConvertSatToString8(info.Currenttotal)
-		}
-	} else {
-		msg = "Error while retrieving account information - try again later."
+	msg := newTgMsg()
+
+	info, err := g_poolClient.AccountInfo(account)
+	switch {
+	case err == nil:
+		part := func(sat int64, div float64) string { return formatPart(lang, float64(sat)/div, 2) }
+		msg.TextCode(tr(lang, "account_info"), account).Text("\n" +
+			tr(lang, "total_rewards") + ": " + part(info.Accumulated, SatPerPart*SatPerPart) +
+			", " + tr(lang, "confirmed_payout") + ": " + part(info.Rewardpaidout, SatPerPart) +
+			", " + tr(lang, "unconfirmed_payout") + ": " + part(info.Rewardpending, SatPerPart) +
+			", " + tr(lang, "open_payout") + ": " + part(info.Accumulated/SatPerPart-info.Rewardpaidout-info.Rewardpending, SatPerPart) +
+			", " + tr(lang, "last_staking_weight") + ": " + part(info.Currenttotal, SatPerPart))
+	case errors.Is(err, ErrPoolInvalidAddress) || errors.Is(err, ErrPoolNotFound):
+		msg.TextCode(tr(lang, poolErrorKey(err)), account)
+	default:
+		msg.Text(tr(lang, poolErrorKey(err)))
 	}
 
-	telegramSendMessage(chatId, msg)
+	telegramSendFormatted(chatId, msg)
 }
 
 func telegramCmdStakeInfo(chatId int64, args []string) {
+	lang := telegramChatLanguage(chatId)
 	var amount float64
 
 	if len(args) >= 1 {
 		var err error
-		amount, err = strconv.ParseFloat(args[0], 64)
+		amount, err = parseAmount(lang, args[0])
 		if err != nil {
-			telegramSendMessage(chatId, "PART amount value \""+args[0]+"\" is not valid.")
+			telegramSendMessage(chatId, tr(lang, "invalid_amount", args[0]))
 			return
 		}
 	}
 
+	telegramSendMessage(chatId, telegramStakeInfoMsg(lang, amount))
+}
+
+func telegramStakeInfoMsg(lang string, amount float64) string {
 	g_particldStatusMutex.Lock()
 	status := g_particldStatus
 	g_particldStatusMutex.Unlock()
 
-	msg := fmt.Sprintf("Nominal annual staking interest rate: %.1f\n", status.NominalRate)
-	msg += fmt.Sprintf("Actual annual staking interest rate: %.1f\n", status.ActualRate)
+	msg := tr(lang, "nominal_rate", formatNumber(lang, status.NominalRate, 1)) + "\n"
+	msg += tr(lang, "actual_rate", formatNumber(lang, status.ActualRate, 1)) + "\n"
+	if status.ActualRate30d > 0 {
+		msg += tr(lang, "rolling_rate", formatNumber(lang, status.ActualRate7d, 1),
+			formatNumber(lang, status.ActualRate30d, 1)) + "\n"
+	}
 
 	if amount > 0 {
 		reward := amount * status.NominalRate / 100 / 365
-		msg += fmt.Sprintf("Nominal daily reward for staking %.2f PART: %.2f PART\n", amount, reward)
+		msg += tr(lang, "nominal_reward", formatPart(lang, amount, 2), formatPart(lang, reward, 2)) + "\n"
 
 		reward = amount * status.ActualRate / 100 / 365
-		msg += fmt.Sprintf("Actual daily reward for staking %.2f PART: %.2f PART\n", amount, reward)
+		msg += tr(lang, "actual_reward", formatPart(lang, amount, 2), formatPart(lang, reward, 2)) + "\n"
+	}
+
+	return msg
+}
+
+func telegramCmdHistory(chatId int64, args []string) {
+	lang := telegramChatLanguage(chatId)
+	daily := true
+
+	if len(args) >= 1 {
+		switch args[0] {
+		case "hourly":
+			daily = false
+		case "daily":
+			daily = true
+		case "network":
+			telegramCmdNetworkHistory(chatId, lang, false)
+			return
+		case "weight":
+			telegramCmdNetworkHistory(chatId, lang, true)
+			return
+		default:
+			telegramSendMessage(chatId, tr(lang, "invalid_history", args[0]))
+			return
+		}
+	}
+
+	hist := stakingRateHistoryCopy(daily)
+
+	if len(hist) == 0 {
+		telegramSendMessage(chatId, tr(lang, "no_history"))
+		return
 	}
 
-	telegramSendMessage(chatId, msg)
+	caption := newTgMsg()
+	if daily {
+		caption.Bold(tr(lang, "history_caption_daily"))
+	} else {
+		caption.Bold(tr(lang, "history_caption_hourly"))
+	}
+	caption.Text("\n" + tr(lang, "history_legend"))
+
+	chart, err := renderStakingRateChart(hist, daily)
+	if err == nil {
+		if telegramSendPhoto(chatId, chart, caption) {
+			return
+		}
+	} else {
+		fmt.Printf("telegramCmdHistory: chart rendering failed: %v\n", err)
+	}
+
+	telegramSendFormatted(chatId, stakingRateHistoryTable(lang, hist, daily))
 }
 
-/*
-Bot Commands:
+// returns a copy of the current daily or hourly staking rate history
+func stakingRateHistoryCopy(daily bool) []StakingRateHistory {
+	var hist []StakingRateHistory
 
-status - Get Particl node status
-accountinfo <account id> - Get account balance in staking pool
-stakeinfo [<amount part>] - Get staking interest info
-*/
+	g_particldStatusMutex.Lock()
+	if daily {
+		hist = make([]StakingRateHistory, len(g_stakingRateHistoryDaily))
+		copy(hist, g_stakingRateHistoryDaily)
+	} else {
+		hist = make([]StakingRateHistory, len(g_stakingRateHistoryHourly))
+		copy(hist, g_stakingRateHistoryHourly)
+	}
+	g_particldStatusMutex.Unlock()
+
+	return hist
+}
+
+// formats staking rate history as fixed width text table, used if chart cannot be sent
+func stakingRateHistoryTable(lang string, hist []StakingRateHistory, daily bool) *tgMsg {
+	table := fmt.Sprintf("%-6s %6s %6s %6s\n", tr(lang, "col_time"), tr(lang, "col_avg"), tr(lang, "col_min"),
+		tr(lang, "col_max"))
+
+	for i := len(hist) - 1; i >= 0; i-- {
+		t := time.Unix(hist[i].Timestamp, 0).UTC()
+		label := t.Format("15:04")
+		if daily {
+			label = t.Format("01-02")
+		}
+		table += fmt.Sprintf("%-6s %6s %6s %6s\n", label, formatNumber(lang, hist[i].AvgRate, 2),
+			formatNumber(lang, hist[i].MinRate, 2), formatNumber(lang, hist[i].MaxRate, 2))
+	}
+
+	return newTgMsg().Bold(tr(lang, "history_table")).Text("\n").Pre(table)
+}
+
+// Bot commands are defined in telegramInitCommands().
 func telegramBot() {
 	updateOffset := 0
+
+	telegramSetMyCommands()
+
 	for {
 		var updateObj []TGUpdate
 
@@ -761,6 +1007,11 @@ func telegramBot() {
 			for _, o := range updateObj {
 				updateOffset = o.Update_id + 1
 
+				if o.Callback_query.Id != "" {
+					telegramDispatchCallback(o.Callback_query)
+					continue
+				}
+
 				m := o.Message
 
 				if m.Date == 0 {
@@ -783,8 +1034,6 @@ func telegramBot() {
 					fmt.Printf("TG: Bot removed from chat %s(%d)\n", m.Chat.Title, m.Chat.Id)
 				}
 
-				user := m.From.First_name
-
 				var cmd string
 				var args []string
 
@@ -811,23 +1060,7 @@ func telegramBot() {
 
 				if cmd != "" {
 					fmt.Printf("TG cmd: %s, args: %s\n", cmd, strings.Join(args, ":"))
-					switch cmd {
-					case "/start":
-						telegramCmdStart(m.Chat.Id, user)
-
-					case "/status":
-						telegramCmdStatus(m.Chat.Id)
-
-					case "/accountinfo":
-						telegramCmdAccountInfo(m.Chat.Id, args)
-
-					case "/stakeinfo":
-						telegramCmdStakeInfo(m.Chat.Id, args)
-
-					default:
-						telegramSendMessage(m.Chat.Id, "Invalid command.")
-
-					}
+					telegramDispatchCommand(m.Chat.Id, m.From, strings.TrimPrefix(cmd, "/"), args)
 				}
 			}
 		} else {
@@ -836,68 +1069,35 @@ func telegramBot() {
 	}
 }
 
-func telegramRegularMessages() {
-	if g_tgConfig.StatusMsgHour < 0 || g_tgConfig.StatusMsgHour > 23 {
-		fmt.Printf("TG: invalid status message hour value: %d\n", g_tgConfig.StatusMsgHour)
-		return
-	}
-	if g_tgConfig.StatusMsgMinute < 0 || g_tgConfig.StatusMsgMinute > 59 {
-		fmt.Printf("TG: invalid status message minute value: %d\n", g_tgConfig.StatusMsgMinute)
-		return
-	}
-	if g_tgConfig.StatusMsgChatName == "" {
-		fmt.Printf("TG: no chat name set.\n")
-		return
-	}
-
-	ok, chatId := telegramGetChat(g_tgConfig.StatusMsgChatName)
+func sendEmail(to, from, subject, body string, important bool) bool {
+	m := gomail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", subject)
 
-	if !ok {
-		fmt.Printf("TG: Failed to retrieve chat id for chat %s.\n", g_tgConfig.StatusMsgChatName)
-		return
+	if important {
+		m.SetHeader("Importance", "high")
 	}
+	m.SetBody("text/plain", body)
 
-	fmt.Printf("Sending Telegram status message at %02d:%02d UTC to chat %s(%d).\n", g_tgConfig.StatusMsgHour,
-		g_tgConfig.StatusMsgMinute, g_tgConfig.StatusMsgChatName, chatId)
-
-	toTc := func(h, m int) int { return h*60 + m }
-	timeToTc := func(t time.Time) int { return toTc(t.Hour(), t.Minute()) }
-
-	triggerTc := toTc(g_tgConfig.StatusMsgHour, g_tgConfig.StatusMsgMinute)
-	lastTc := -1
-
-	for {
-		now := timeToTc(time.Now().UTC())
-
-		if now != lastTc {
-			lastTc = now
-			//fmt.Printf("timer: %d\n", now)
-			if now == triggerTc {
-				telegramCmdStatus(chatId)
-			}
-		}
-
-		time.Sleep(1 * time.Second)
+	d := gomail.Dialer{Host: "localhost", Port: 25}
+	if err := d.DialAndSend(m); err != nil {
+		fmt.Printf("Failed to send email to %s: %s\n", to, err.Error())
+		return false
 	}
+
+	return true
 }
 
-func sendWatchdogEmail(msg string) {
+func sendWatchdogEmail(msg string, important bool) {
 	if g_config.WatchdogEmailTo != "" && g_config.WatchdogEmailFrom != "" {
-		m := gomail.NewMessage()
-		m.SetHeader("From", g_config.WatchdogEmailFrom)
-		m.SetHeader("To", g_config.WatchdogEmailTo)
-		if g_config.WatchdogEmailSubject == "" {
-			m.SetHeader("Subject", "Particld Watchdog Alert")
-		} else {
-			m.SetHeader("Subject", g_config.WatchdogEmailSubject)
+		subject := g_config.WatchdogEmailSubject
+		if subject == "" {
+			subject = tr(watchdogLanguage(), "wd_mail_subject")
 		}
 
-		m.SetHeader("Importance", "high")
-		m.SetBody("text/plain", msg)
-
-		d := gomail.Dialer{Host: "localhost", Port: 25}
-		if err := d.DialAndSend(m); err != nil {
-			fmt.Printf("Particld Watchdog: Failed to send email: %s\n", err.Error())
+		if !sendEmail(g_config.WatchdogEmailTo, g_config.WatchdogEmailFrom, subject, msg, important) {
+			fmt.Printf("Watchdog: Failed to send email.\n")
 		}
 	}
 }
@@ -906,39 +1106,55 @@ func particldWatchdog() {
 	msg := ""
 	lastMsg := ""
 
-	var chatId int64
-	chatIdOk := false
-
-	if g_TGBotEnabled && g_tgConfig.WatchdogMsgChatName != "" {
-		chatIdOk, chatId = telegramGetChat(g_tgConfig.WatchdogMsgChatName)
-
-		if !chatIdOk {
-			fmt.Printf("TG: Failed to retrieve chat id for chat %s.\n", g_tgConfig.WatchdogMsgChatName)
-		}
-	}
+	lang := watchdogLanguage()
 
 	prpc := particlrpc.NewParticlRpc()
 	prpc.SetRpcPort(g_config.ParticldRpcPort)
 	prpc.SetDataDirectoy(g_config.ParticldDataDir)
 
+	var lastWeight float64
+
 	for {
+		ok := false
 		err := prpc.ReadPartRpcCookie()
 
 		if err != nil {
-			msg = "communication to particld failed."
+			msg = tr(lang, "wd_comm_failed")
 			fmt.Printf("Particld Watchdog: failed to read particld cookie: %s\n", err.Error())
 		} else {
 			stakeinfo, err := prpc.GetStakingInfo(g_config.ParticldStakingWallet)
 
+			wallet, werr := walletCheck(prpc, stakeinfo)
+			if werr == nil {
+				walletHealthSet(wallet)
+			} else {
+				fmt.Printf("Particld Watchdog: wallet check failed: %v\n", werr)
+			}
+
 			if err != nil {
-				msg = fmt.Sprintf("communication to particld failed.")
+				msg = tr(lang, "wd_comm_failed")
+				if werr == nil && wallet.Issue == walletIssueNotLoaded {
+					msg = walletIssueText(lang, wallet)
+				}
 				fmt.Printf("Particld Watchdog: particld communication error: %s\n", err.Error())
 			} else {
 				if stakeinfo.Staking {
-					msg = "normal operation"
+					msg = tr(lang, "wd_normal")
+					ok = true
+				} else if cause := walletIssueText(lang, wallet); werr == nil && cause != "" {
+					msg = tr(lang, "wd_not_staking", cause)
 				} else {
-					msg = fmt.Sprintf("particld is not staking, cause: %s", stakeinfo.Errors)
+					msg = tr(lang, "wd_not_staking", stakeinfo.Errors)
 				}
+
+				weight := float64(stakeinfo.Weight) / SatPerPart
+				if walletWeightDropped(lastWeight, weight) {
+					drop := tr(lang, "wd_weight_drop", formatNumber(lang, (lastWeight-weight)*100/lastWeight, 1),
+						formatPart(lang, lastWeight, 0), formatPart(lang, weight, 0))
+					fmt.Printf("Particld Watchdog: %s\n", drop)
+					watchdogAlert(tr(lang, "wd_prefix", drop) + "\n")
+				}
+				lastWeight = weight
 			}
 		}
 
@@ -946,13 +1162,10 @@ func particldWatchdog() {
 			lastMsg = msg
 			fmt.Printf("Particld Watchdog: %s\n", msg)
 
-			msg = fmt.Sprintf("Particld watchdog: %s\n", msg)
+			watchdogRecordEvent("particld", ok, msg)
+			eventsPublish("watchdog", map[string]interface{}{"source": "particld", "ok": ok, "message": msg})
 
-			if chatIdOk {
-				telegramSendMessage(chatId, msg)
-			}
-
-			sendWatchdogEmail(msg)
+			watchdogAlert(tr(lang, "wd_prefix", msg) + "\n")
 		}
 
 		time.Sleep(60 * time.Second)
@@ -967,6 +1180,10 @@ func signalHandler() {
 
 	fmt.Printf("%s: Received Signal: %s\n", g_prgName, s.String())
 
+	if g_db == nil {
+		rateBufferSave()
+	}
+
 	if g_httpServer != nil {
 		if err := g_httpServer.Shutdown(context.Background()); err != nil {
 			// Error from closing listeners, or context timeout:
@@ -994,104 +1211,59 @@ func handleDaemonStats(resp http.ResponseWriter, req *http.Request) {
 }
 
 func handleStakingRateHistoryHourly(resp http.ResponseWriter, req *http.Request) {
-	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
-	resp.Header().Set("Access-Control-Allow-Origin", "*")
-
-	var hist []StakingRateHistory
-
-	g_particldStatusMutex.Lock()
-	hist = make([]StakingRateHistory, len(g_stakingRateHistoryHourly))
-	copy(hist, g_stakingRateHistoryHourly)
-	g_particldStatusMutex.Unlock()
-
-	data := make([][]interface{}, 0, len(hist))
-
-	for i := len(hist) - 1; i >= 0; i-- {
-		t := time.Unix(hist[i].Timestamp, 0)
-
-		data = append(data, []interface{}{t.Hour(), hist[i].AvgRate})
-	}
-
-	d, err := json.Marshal(data)
-	if err != nil {
-		fmt.Printf("Marshal: %v", err)
-	}
-	io.WriteString(resp, string(d))
-
+	writeStakingRateHistory(resp, req, "handleStakingRateHistoryHourly", func(loc *time.Location) (interface{}, error) {
+		return stakingRateHistoryPoints(loc, false)
+	})
 }
 
 func handleStakingRateHistoryDaily(resp http.ResponseWriter, req *http.Request) {
-	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
-	resp.Header().Set("Access-Control-Allow-Origin", "*")
-
-	var hist []StakingRateHistory
-
-	g_particldStatusMutex.Lock()
-	hist = make([]StakingRateHistory, len(g_stakingRateHistoryDaily))
-	copy(hist, g_stakingRateHistoryDaily)
-	g_particldStatusMutex.Unlock()
-
-	data := make([][]interface{}, 0, len(hist))
-
-	for i := len(hist) - 1; i >= 0; i-- {
-		t := time.Unix(hist[i].Timestamp, 0)
-
-		data = append(data, []interface{}{t.Day(), hist[i].AvgRate})
-	}
-
-	d, err := json.Marshal(data)
-	if err != nil {
-		fmt.Printf("Marshal: %v", err)
-	}
-	io.WriteString(resp, string(d))
-
+	writeStakingRateHistory(resp, req, "handleStakingRateHistoryDaily", func(loc *time.Location) (interface{}, error) {
+		return stakingRateHistoryPoints(loc, true)
+	})
 }
 
 func handleStakingRateHistory(resp http.ResponseWriter, req *http.Request) {
-	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
-	resp.Header().Set("Access-Control-Allow-Origin", "*")
-
-	var histHourly []StakingRateHistory
-	var histDaily []StakingRateHistory
-
-	g_particldStatusMutex.Lock()
-	histDaily = make([]StakingRateHistory, len(g_stakingRateHistoryDaily))
-	histHourly = make([]StakingRateHistory, len(g_stakingRateHistoryHourly))
-	copy(histDaily, g_stakingRateHistoryDaily)
-	copy(histHourly, g_stakingRateHistoryHourly)
-	g_particldStatusMutex.Unlock()
-
-	res := struct {
-		Daily  [][]interface{} `json:"daily"`
-		Hourly [][]interface{} `json:"hourly"`
-	}{}
-
-	data := make([][]interface{}, 0, len(histDaily))
-
-	for i := len(histDaily) - 1; i >= 0; i-- {
-		//t := time.Unix(histDaily[i].Timestamp, 0).UTC()
-
-		data = append(data, []interface{}{histDaily[i].Timestamp, histDaily[i].AvgRate, histDaily[i].MinRate, histDaily[i].MaxRate})
-	}
+	writeStakingRateHistory(resp, req, "handleStakingRateHistory", func(loc *time.Location) (interface{}, error) {
+		var histHourly []StakingRateHistory
+		var histDaily []StakingRateHistory
+
+		if loc == nil {
+			loc = time.UTC
+			histDaily = stakingRateHistoryCopy(true)
+			histHourly = stakingRateHistoryCopy(false)
+		} else {
+			var err error
+			if histDaily, err = stakingRateHistoryForLocation(loc, true); err != nil {
+				return nil, err
+			}
+			if histHourly, err = stakingRateHistoryForLocation(loc, false); err != nil {
+				return nil, err
+			}
+		}
 
-	res.Daily = data
+		res := struct {
+			Daily  [][]interface{} `json:"daily"`
+			Hourly [][]interface{} `json:"hourly"`
+		}{}
 
-	data = make([][]interface{}, 0, len(histHourly))
+		points := func(hist []StakingRateHistory) [][]interface{} {
+			data := make([][]interface{}, 0, len(hist))
 
-	for i := len(histHourly) - 1; i >= 0; i-- {
-		//t := time.Unix(histHourly[i].Timestamp, 0).UTC()
+			for i := len(hist) - 1; i >= 0; i-- {
+				t := time.Unix(hist[i].Timestamp, 0).In(loc)
 
-		data = append(data, []interface{}{histHourly[i].Timestamp, histHourly[i].AvgRate, histHourly[i].MinRate, histHourly[i].MaxRate})
-	}
+				data = append(data, []interface{}{hist[i].Timestamp, hist[i].AvgRate, hist[i].MinRate, hist[i].MaxRate,
+					t.Format(time.RFC3339)})
+			}
 
-	res.Hourly = data
+			return data
+		}
 
-	d, err := json.Marshal(res)
-	if err != nil {
-		fmt.Printf("Marshal: %v\n", err)
-	}
-	io.WriteString(resp, string(d))
+		res.Daily = points(histDaily)
+		res.Hourly = points(histHourly)
 
+		return res, nil
+	})
 }
 
 func stakingCtl(enabled bool) string {
@@ -1153,10 +1325,15 @@ func handleStakingOff(resp http.ResponseWriter, req *http.Request) {
 
 func main() {
 
+	if len(os.Args) >= 2 && os.Args[1] == "export" {
+		os.Exit(exportMain(os.Args[2:]))
+	}
+
 	fmt.Printf("Started %s\n", g_prgName)
 
 	if len(os.Args) < 2 || len(os.Args) > 3 {
 		fmt.Printf("Usage: %s <config file> [<telegram config file>]\n", g_prgName)
+		fmt.Printf("       %s export <config file> [-from <time>] [-to <time>] [-interval <interval>] [-format csv|jsonl] [-gzip] [-o <file>]\n", g_prgName)
 		os.Exit(1)
 	}
 
@@ -1174,30 +1351,64 @@ func main() {
 		}
 	}
 
+	poolClientInit()
+
 	if g_config.DbUrl != "" {
 		g_db = dbConnect()
 
 		if g_db == nil {
 			os.Exit(1)
 		}
+
+		g_dbTables = dbInit()
+		if !g_dbTables {
+			fmt.Printf("%s: Failed to set up history tables, keeping watchdog, node and block history in memory.\n", g_prgName)
+		}
+	}
+
+	if g_db == nil {
+		rateBufferLoad()
+	}
+	if !g_dbTables {
+		nodeStatsLoad()
 	}
 
 	go particldStatusCollector()
+	go blockScanner()
+
+	if g_config.ColdStakingAddress != "" {
+		go delegationCollector()
+	}
+
+	if g_config.StakePoolUrl != "" {
+		go poolStatsCollector()
+	}
 
 	if g_db != nil {
 		go stakingRewardCollector()
-		go stakingRateHistoryCollector()
 	}
+	go stakingRateHistoryCollector()
 
 	if g_tgConfig.BotName != "" && g_tgConfig.BotAuth != "" {
 		g_TGBotEnabled = true
+		telegramInitCommands()
+		telegramLoadChatLanguages()
+		telegramLoadOutbox()
+		go telegramSender()
 		go telegramBot()
-		go telegramRegularMessages()
+		go telegramScheduler()
 	}
 
-	if (g_TGBotEnabled && g_tgConfig.WatchdogMsgChatName != "") ||
-		(g_config.WatchdogEmailFrom != "" && g_config.WatchdogEmailTo != "") {
+	if watchdogEnabled() {
 		go particldWatchdog()
+
+		if g_config.StakePoolUrl != "" && !g_config.PoolWatchdogDisabled {
+			go poolWatchdog()
+		}
+	}
+
+	if g_config.DigestEmailTo != "" && digestEmailFrom() != "" {
+		go digestMailer()
 	}
 
 	if g_config.Port > 0 {
@@ -1208,11 +1419,33 @@ func main() {
 			WriteTimeout:   10 * time.Second,
 			MaxHeaderBytes: 1 << 20,
 		}
+		g_httpServer.RegisterOnShutdown(eventsShutdown)
 
 		http.HandleFunc("/stat", handleDaemonStats)
 		http.HandleFunc("/stakingrate", handleStakingRateHistory)
 		http.HandleFunc("/stakingrate/hourly", handleStakingRateHistoryHourly)
 		http.HandleFunc("/stakingrate/daily", handleStakingRateHistoryDaily)
+		http.HandleFunc("/stakingrate/query", handleStakingRateQuery)
+		http.HandleFunc("/stakingrate/export", handleStakingRateExport)
+		http.HandleFunc("/stakingrate/stats", handleStakingRateStats)
+		http.HandleFunc("/calc", handleCalc)
+		http.HandleFunc("/pool", handlePoolStats)
+		http.HandleFunc("/blocks", handlePoolBlocks)
+		http.HandleFunc("/network", handleNetworkStats)
+		http.HandleFunc("/events", handleEvents)
+		http.HandleFunc("/account/", handleAccountInfo)
+		http.HandleFunc("/watchdog/events", handleWatchdogEvents)
+		http.HandleFunc("/badge/staking.svg", handleBadgeStaking)
+		http.HandleFunc("/badge/rate.svg", handleBadgeRate)
+		http.HandleFunc("/sparkline.svg", handleSparkline)
+		http.Handle("/", dashboardHandler())
+		http.HandleFunc("/blocknotify", handleBlockNotify)
+		http.HandleFunc("/blocknotify/", handleBlockNotify)
+
+		if g_config.ApiKey != "" {
+			http.HandleFunc("/delegations/"+g_config.ApiKey, handleDelegations)
+			http.HandleFunc("/wallet/"+g_config.ApiKey, handleWalletHealth)
+		}
 
 		if g_config.ParticldStakingCtlKey != "" {
 			http.HandleFunc("/staking/"+g_config.ParticldStakingCtlKey+"/1", handleStakingOn)
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const networkStatsDefaultDays = 30
+const networkStatsMaxRange = 400 * SecondsPerDay
+
+// last sample of each UTC day, in ascending time order
+func nodeStatsDaily(samples []NodeStatsSample) []NodeStatsSample {
+	var res []NodeStatsSample
+
+	for _, s := range samples {
+		if n := len(res); n > 0 && res[n-1].Time/SecondsPerDay == s.Time/SecondsPerDay {
+			res[n-1] = s
+		} else {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// samples with network weight, money supply and peers
+func nodeStatsNetwork(samples []NodeStatsSample) []NodeStatsSample {
+	res := make([]NodeStatsSample, 0, len(samples))
+
+	for _, s := range samples {
+		if s.Network {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// network participation in percent, i.e. network staking weight relative to money supply
+func networkParticipation(s NodeStatsSample) float64 {
+	if s.MoneySupply <= 0 {
+		return 0
+	}
+	return float64(s.NetWeight) / SatPerPart / s.MoneySupply * 100
+}
+
+// renders network staking weight and money supply of daily samples in million PART as PNG chart
+func renderNetworkChart(daily []NodeStatsSample) ([]byte, error) {
+	n := len(daily)
+	labels := make([]string, n)
+	netWeight := chartSeries{make([]float64, n), chartColorAvg, 3}
+	supply := chartSeries{make([]float64, n), chartColorMinMax, 3}
+
+	for i, s := range daily {
+		labels[i] = time.Unix(s.Time, 0).UTC().Format("01-02")
+		netWeight.Values[i] = float64(s.NetWeight) / SatPerPart / 1e6
+		supply.Values[i] = s.MoneySupply / 1e6
+	}
+
+	return renderLineChart(labels, []chartSeries{supply, netWeight}, "%.2f")
+}
+
+// renders the staking weight of the pool of daily samples in thousand PART as PNG chart
+func renderWeightChart(daily []NodeStatsSample) ([]byte, error) {
+	n := len(daily)
+	labels := make([]string, n)
+	weight := chartSeries{make([]float64, n), chartColorAvg, 3}
+
+	for i, s := range daily {
+		labels[i] = time.Unix(s.Time, 0).UTC().Format("01-02")
+		weight.Values[i] = float64(s.Weight) / SatPerPart / 1e3
+	}
+
+	return renderLineChart(labels, []chartSeries{weight}, "%.1f")
+}
+
+// formats daily network statistics as fixed width text table, used if chart cannot be sent
+func networkStatsTable(lang string, daily []NodeStatsSample) *tgMsg {
+	table := fmt.Sprintf("%-6s %10s %10s %10s\n", tr(lang, "col_time"), tr(lang, "col_net_weight"),
+		tr(lang, "col_supply"), tr(lang, "col_weight"))
+
+	for _, s := range daily {
+		netWeight, supply := "-", "-"
+		if s.Network {
+			netWeight = formatNumber(lang, float64(s.NetWeight)/SatPerPart/1e6, 3)
+			supply = formatNumber(lang, s.MoneySupply/1e6, 3)
+		}
+		table += fmt.Sprintf("%-6s %10s %10s %10s\n", time.Unix(s.Time, 0).UTC().Format("01-02"), netWeight, supply,
+			formatNumber(lang, float64(s.Weight)/SatPerPart/1e3, 1))
+	}
+
+	return newTgMsg().Bold(tr(lang, "network_table")).Text("\n").Pre(table)
+}
+
+// sends chart of network staking weight and money supply or of the pool's staking weight of the last 30 days
+func telegramCmdNetworkHistory(chatId int64, lang string, weight bool) {
+	to := time.Now().Unix()
+	samples, err := nodeStatsSamples(to-networkStatsDefaultDays*SecondsPerDay, to+1)
+	if err != nil {
+		telegramSendMessage(chatId, tr(lang, "no_network_stats"))
+		return
+	}
+	if !weight {
+		samples = nodeStatsNetwork(samples)
+	}
+	daily := nodeStatsDaily(samples)
+
+	if len(daily) == 0 {
+		telegramSendMessage(chatId, tr(lang, "no_network_stats"))
+		return
+	}
+
+	var chart []byte
+	caption := newTgMsg()
+
+	if weight {
+		caption.Bold(tr(lang, "history_caption_weight"))
+		chart, err = renderWeightChart(daily)
+	} else {
+		caption.Bold(tr(lang, "history_caption_network")).Text("\n" + tr(lang, "network_legend"))
+		caption.Text("\n" + tr(lang, "network_participation",
+			formatNumber(lang, networkParticipation(daily[len(daily)-1]), 1)))
+		chart, err = renderNetworkChart(daily)
+	}
+
+	if err == nil {
+		if telegramSendPhoto(chatId, chart, caption) {
+			return
+		}
+	} else {
+		fmt.Printf("telegramCmdNetworkHistory: chart rendering failed: %v\n", err)
+	}
+
+	telegramSendFormatted(chatId, networkStatsTable(lang, daily))
+}
+
+// GET /network?from=<time>&to=<time>
+func handleNetworkStats(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	q := req.URL.Query()
+	var err error
+
+	to := time.Now().Unix()
+	if v := q.Get("to"); v != "" {
+		if to, err = parseTimeParam(v); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_to")
+			return
+		}
+	}
+
+	from := to - networkStatsDefaultDays*SecondsPerDay
+	if v := q.Get("from"); v != "" {
+		if from, err = parseTimeParam(v); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_from")
+			return
+		}
+	}
+
+	if from < 0 || from >= to || to-from > networkStatsMaxRange {
+		writeJsonError(resp, http.StatusBadRequest, "invalid_range")
+		return
+	}
+
+	samples, err := nodeStatsSamples(from, to)
+	if err != nil {
+		writeJsonError(resp, http.StatusInternalServerError, "query_failed")
+		return
+	}
+	samples = nodeStatsNetwork(samples)
+
+	res := struct {
+		From    int64             `json:"from"`
+		To      int64             `json:"to"`
+		Samples []NodeStatsSample `json:"samples"`
+	}{from, to, samples}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		fmt.Printf("handleNetworkStats: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
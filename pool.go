@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// global pool summary as returned by <StakePoolUrl>/json, amounts in satoshi
+type PoolSummary struct {
+	Poolheight            int64           `json:"poolheight"`
+	Stakeweight           int64           `json:"stakeweight"`
+	Watchonlytotalbalance int64           `json:"watchonlytotalbalance"`
+	Numaccounts           int64           `json:"numaccounts"`
+	Blocksfound           int64           `json:"blocksfound"`
+	Lastblocks            [][]interface{} `json:"lastblocks"`
+	Pendingpayments       []PoolPayment   `json:"pendingpayments"`
+}
+
+type PoolPayment struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+}
+
+type PoolStats struct {
+	Ok             bool    `json:"ok"`
+	Updated        int64   `json:"updated"`
+	Height         int64   `json:"height"`
+	StakeWeight    float64 `json:"stake_weight"`
+	Balance        float64 `json:"balance"`
+	Accounts       int64   `json:"accounts"`
+	BlocksFound    int64   `json:"blocks_found"`
+	LastBlockFound int64   `json:"last_block_found"`
+	PendingPayouts int     `json:"pending_payouts"`
+	PendingAmount  float64 `json:"pending_amount"`
+}
+
+const poolStatsDefaultInterval = 5 * 60
+
+var g_poolStats PoolStats
+var g_poolStatsMutex sync.Mutex
+
+func poolStatsFromSummary(s *PoolSummary) PoolStats {
+	stats := PoolStats{Ok: true, Updated: time.Now().Unix(), Height: s.Poolheight,
+		StakeWeight: float64(s.Stakeweight) / SatPerPart, Balance: float64(s.Watchonlytotalbalance) / SatPerPart,
+		Accounts: s.Numaccounts, BlocksFound: s.Blocksfound, PendingPayouts: len(s.Pendingpayments)}
+
+	// last blocks are lists starting with the block height
+	for _, b := range s.Lastblocks {
+		if len(b) == 0 {
+			continue
+		}
+		if h, ok := b[0].(float64); ok && int64(h) > stats.LastBlockFound {
+			stats.LastBlockFound = int64(h)
+		}
+	}
+
+	var pending int64
+	for _, p := range s.Pendingpayments {
+		pending += p.Amount
+	}
+	stats.PendingAmount = float64(pending) / SatPerPart
+
+	return stats
+}
+
+func poolStatsCopy() PoolStats {
+	g_poolStatsMutex.Lock()
+	defer g_poolStatsMutex.Unlock()
+	return g_poolStats
+}
+
+// periodically fetches the global pool summary, on failure the last retrieved values are kept
+func poolStatsCollector() {
+	interval := g_config.PoolStatsInterval
+	if interval <= 0 {
+		interval = poolStatsDefaultInterval
+	}
+
+	for {
+		summary, err := g_poolClient.Summary()
+
+		if err == nil {
+			stats := poolStatsFromSummary(&summary)
+
+			g_poolStatsMutex.Lock()
+			g_poolStats = stats
+			g_poolStatsMutex.Unlock()
+		} else {
+			fmt.Printf("poolStatsCollector: failed to retrieve pool summary: %v\n", err)
+
+			g_poolStatsMutex.Lock()
+			g_poolStats.Ok = false
+			g_poolStatsMutex.Unlock()
+		}
+
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+func telegramCmdPoolInfo(chatId int64) {
+	lang := telegramChatLanguage(chatId)
+	stats := poolStatsCopy()
+
+	if stats.Updated == 0 {
+		telegramSendMessage(chatId, tr(lang, "pool_no_data"))
+		return
+	}
+
+	rows := [][2]string{
+		{tr(lang, "lbl_updated"), time.Unix(stats.Updated, 0).UTC().Format("2006-01-02 15:04 MST")},
+		{tr(lang, "lbl_pool_height"), fmt.Sprintf("%d", stats.Height)},
+		{tr(lang, "lbl_staking"), formatPart(lang, stats.StakeWeight, 0)},
+		{tr(lang, "lbl_balance"), formatPart(lang, stats.Balance, 0)},
+		{tr(lang, "lbl_accounts"), formatNumber(lang, float64(stats.Accounts), 0)},
+		{tr(lang, "lbl_blocks_found"), formatNumber(lang, float64(stats.BlocksFound), 0)},
+		{tr(lang, "lbl_last_block_found"), fmt.Sprintf("%d", stats.LastBlockFound)},
+		{tr(lang, "lbl_pending_payouts"), fmt.Sprintf("%d (%s)", stats.PendingPayouts,
+			formatPart(lang, stats.PendingAmount, 2))},
+	}
+
+	msg := newTgMsg().Bold(tr(lang, "pool_info")).Text("\n").Pre(infoTable(rows))
+	if !stats.Ok {
+		msg.Text(tr(lang, "pool_stale"))
+	}
+
+	telegramSendFormatted(chatId, msg)
+}
+
+func handlePoolStats(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	stats := poolStatsCopy()
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		fmt.Printf("handlePoolStats: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
+
+var g_accountIdRegexp = regexp.MustCompile("^[0-9A-Za-z]{1,128}$")
+
+// GET /account/<account id>, account info from the stake pool server
+func handleAccountInfo(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	account := strings.TrimPrefix(req.URL.Path, "/account/")
+	if !g_accountIdRegexp.MatchString(account) {
+		writeJsonError(resp, http.StatusBadRequest, "invalid_account")
+		return
+	}
+
+	if g_config.StakePoolUrl == "" {
+		writeJsonError(resp, http.StatusServiceUnavailable, "no_pool")
+		return
+	}
+
+	info, err := g_poolClient.AccountInfo(account)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPoolInvalidAddress):
+			writeJsonError(resp, http.StatusBadRequest, "invalid_account")
+		case errors.Is(err, ErrPoolNotFound):
+			writeJsonError(resp, http.StatusNotFound, "unknown_account")
+		case errors.Is(err, ErrPoolTimeout):
+			writeJsonError(resp, http.StatusGatewayTimeout, "pool_timeout")
+		default:
+			writeJsonError(resp, http.StatusBadGateway, "pool_down")
+		}
+		return
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		fmt.Printf("handleAccountInfo: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stand-in for the stake pool JSON HTTP server, serves synthetic data
+
+type poolStub struct {
+	mutex    sync.Mutex
+	height   int64
+	delay    time.Duration
+	status   int
+	body     string
+	requests int
+	lastPath string
+	accounts map[string]PoolAccountInfo
+}
+
+const stubAccount = "pX8nq9M2Ye8SGoRrLGdyfpSyHK9Mj2wBNt"
+const stubUnknownAccount = "pq6RU4sXWdZgkcpFvMYZqEYoV33F4JGpN5"
+
+var g_poolStubAddressRe = regexp.MustCompile(`^[1-9A-HJ-NP-Za-km-z]{26,}$`)
+
+// starts a stub pool server, the server is closed at the end of the test
+func newPoolStubServer(t *testing.T) (*poolStub, *httptest.Server) {
+	s := &poolStub{height: 1000000}
+
+	s.accounts = map[string]PoolAccountInfo{
+		stubAccount: {Accumulated: 152 * SatPerPart * SatPerPart, Rewardpending: 2 * SatPerPart,
+			Rewardpaidout: 140 * SatPerPart, Currenttotal: 12000 * SatPerPart, Laststaking: 999990},
+		"pU1ikwDb2ZG5TnKxZXwRfYDtvHzMVnoyH6": {Accumulated: 37 * SatPerPart * SatPerPart,
+			Rewardpaidout: 35 * SatPerPart, Currenttotal: 2500 * SatPerPart, Laststaking: 999950},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json", s.handleSummary)
+	mux.HandleFunc("/json/address/", s.handleAddress)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return s, srv
+}
+
+// lets all following requests fail with <status> and <body>, status 0 restores normal operation
+func (s *poolStub) fail(status int, body string) {
+	s.mutex.Lock()
+	s.status = status
+	s.body = body
+	s.mutex.Unlock()
+}
+
+func (s *poolStub) requestCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests
+}
+
+func (s *poolStub) requestPath() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastPath
+}
+
+// returns false if the request was answered with the configured failure
+func (s *poolStub) begin(resp http.ResponseWriter, req *http.Request) bool {
+	s.mutex.Lock()
+	s.requests++
+	s.lastPath = req.URL.EscapedPath()
+	delay, status, body := s.delay, s.status, s.body
+	s.mutex.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if status != 0 {
+		resp.WriteHeader(status)
+		io.WriteString(resp, body)
+		return false
+	}
+
+	return true
+}
+
+func (s *poolStub) write(resp http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		fmt.Printf("poolStub: marshal: %v\n", err)
+	}
+
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.WriteHeader(status)
+	io.WriteString(resp, string(data))
+}
+
+func (s *poolStub) handleSummary(resp http.ResponseWriter, req *http.Request) {
+	if !s.begin(resp, req) {
+		return
+	}
+
+	s.mutex.Lock()
+	sum := PoolSummary{Poolheight: s.height, Numaccounts: int64(len(s.accounts)), Blocksfound: s.height / 20}
+	for address, a := range s.accounts {
+		sum.Stakeweight += a.Currenttotal
+		if a.Rewardpending > 0 {
+			sum.Pendingpayments = append(sum.Pendingpayments, PoolPayment{address, a.Rewardpending})
+		}
+	}
+	s.mutex.Unlock()
+
+	sum.Watchonlytotalbalance = sum.Stakeweight
+	sum.Lastblocks = append(sum.Lastblocks, []interface{}{sum.Poolheight, fmt.Sprintf("%064x", sum.Poolheight),
+		7 * SatPerPart / 10})
+
+	s.write(resp, http.StatusOK, sum)
+}
+
+func (s *poolStub) handleAddress(resp http.ResponseWriter, req *http.Request) {
+	if !s.begin(resp, req) {
+		return
+	}
+
+	address := strings.TrimPrefix(req.URL.Path, "/json/address/")
+
+	if !g_poolStubAddressRe.MatchString(address) {
+		s.write(resp, http.StatusOK, PoolAccountInfo{Error: "Invalid address"})
+		return
+	}
+
+	s.mutex.Lock()
+	info, ok := s.accounts[address]
+	s.mutex.Unlock()
+
+	if !ok {
+		s.write(resp, http.StatusNotFound, PoolAccountInfo{Error: "Unknown address"})
+		return
+	}
+
+	s.write(resp, http.StatusOK, info)
+}
+
+func TestPoolClientSummary(t *testing.T) {
+	_, srv := newPoolStubServer(t)
+	c := newPoolClient(srv.URL+"/", time.Second, time.Minute)
+
+	sum, err := c.Summary()
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if sum.Poolheight != 1000000 || sum.Numaccounts != 2 || sum.Stakeweight != 14500*SatPerPart {
+		t.Errorf("Summary: unexpected result %+v", sum)
+	}
+	if len(sum.Pendingpayments) != 1 || sum.Pendingpayments[0].Address != stubAccount {
+		t.Errorf("Summary: unexpected pending payments %+v", sum.Pendingpayments)
+	}
+}
+
+func TestPoolClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		account string
+		want    error
+		key     string
+	}{
+		{"invalid address", 0, "", "x", ErrPoolInvalidAddress, "account_invalid"},
+		{"unknown address", 0, "", stubUnknownAccount, ErrPoolNotFound, "account_not_found"},
+		{"not found", http.StatusNotFound, "", stubAccount, ErrPoolNotFound, "account_not_found"},
+		{"server error", http.StatusBadGateway, "", stubAccount, ErrPoolDown, "pool_down"},
+		{"bad status", http.StatusForbidden, "", stubAccount, ErrPoolBadResponse, "account_error"},
+		{"bad json", http.StatusOK, "<html>", stubAccount, ErrPoolBadResponse, "account_error"},
+		{"error field", http.StatusOK, `{"error": "database locked"}`, stubAccount, ErrPoolBadResponse, "account_error"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, srv := newPoolStubServer(t)
+			s.fail(tc.status, tc.body)
+			c := newPoolClient(srv.URL, time.Second, time.Minute)
+
+			_, err := c.AccountInfo(tc.account)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("AccountInfo: got error %v, want %v", err, tc.want)
+			}
+			if key := poolErrorKey(err); key != tc.key {
+				t.Errorf("poolErrorKey: got %s, want %s", key, tc.key)
+			}
+		})
+	}
+}
+
+func TestPoolClientTimeout(t *testing.T) {
+	s, srv := newPoolStubServer(t)
+	s.delay = 200 * time.Millisecond
+	c := newPoolClient(srv.URL, 50*time.Millisecond, time.Minute)
+
+	if _, err := c.Summary(); !errors.Is(err, ErrPoolTimeout) {
+		t.Fatalf("Summary: got error %v, want %v", err, ErrPoolTimeout)
+	}
+}
+
+func TestPoolClientDown(t *testing.T) {
+	_, srv := newPoolStubServer(t)
+	srv.Close()
+	c := newPoolClient(srv.URL, time.Second, time.Minute)
+
+	if _, err := c.Summary(); !errors.Is(err, ErrPoolDown) {
+		t.Fatalf("Summary: got error %v, want %v", err, ErrPoolDown)
+	}
+
+	c = newPoolClient("", time.Second, time.Minute)
+	if _, err := c.Summary(); !errors.Is(err, ErrPoolDown) {
+		t.Fatalf("Summary without URL: got error %v, want %v", err, ErrPoolDown)
+	}
+}
+
+func TestPoolClientCache(t *testing.T) {
+	s, srv := newPoolStubServer(t)
+	c := newPoolClient(srv.URL, time.Second, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		info, err := c.AccountInfo(stubAccount)
+		if err != nil {
+			t.Fatalf("AccountInfo: %v", err)
+		}
+		if info.Currenttotal != 12000*SatPerPart {
+			t.Fatalf("AccountInfo: unexpected result %+v", info)
+		}
+	}
+	if n := s.requestCount(); n != 1 {
+		t.Errorf("cached account info: got %d requests, want 1", n)
+	}
+
+	// errors are not cached
+	c.AccountInfo(stubUnknownAccount)
+	c.AccountInfo(stubUnknownAccount)
+	if n := s.requestCount(); n != 3 {
+		t.Errorf("unknown account: got %d requests, want 3", n)
+	}
+}
+
+func TestPoolClientCircuitBreaker(t *testing.T) {
+	s, srv := newPoolStubServer(t)
+	s.fail(http.StatusInternalServerError, "")
+	c := newPoolClient(srv.URL, time.Second, time.Minute)
+
+	for i := 0; i < poolBreakerThreshold; i++ {
+		if _, err := c.Summary(); !errors.Is(err, ErrPoolDown) {
+			t.Fatalf("Summary %d: got error %v, want %v", i, err, ErrPoolDown)
+		}
+	}
+
+	// breaker is open, requests are rejected without contacting the server
+	if _, err := c.Summary(); !errors.Is(err, ErrPoolDown) {
+		t.Fatalf("Summary with open breaker: got error %v, want %v", err, ErrPoolDown)
+	}
+	if n := s.requestCount(); n != poolBreakerThreshold {
+		t.Fatalf("open breaker: got %d requests, want %d", n, poolBreakerThreshold)
+	}
+
+	// after the cooldown a failing probe opens the breaker again
+	c.mutex.Lock()
+	c.openUntil = time.Now()
+	c.mutex.Unlock()
+
+	c.Summary()
+	c.Summary()
+	if n := s.requestCount(); n != poolBreakerThreshold+1 {
+		t.Fatalf("failed probe: got %d requests, want %d", n, poolBreakerThreshold+1)
+	}
+
+	// a successful probe closes the breaker
+	s.fail(0, "")
+	c.mutex.Lock()
+	c.openUntil = time.Now()
+	c.mutex.Unlock()
+
+	if _, err := c.Summary(); err != nil {
+		t.Fatalf("Summary probe: %v", err)
+	}
+	if _, err := c.Summary(); err != nil {
+		t.Fatalf("Summary after probe: %v", err)
+	}
+	if n := s.requestCount(); n != poolBreakerThreshold+3 {
+		t.Errorf("closed breaker: got %d requests, want %d", n, poolBreakerThreshold+3)
+	}
+}
+
+func TestPoolClientBreakerIgnoresAccountErrors(t *testing.T) {
+	s, srv := newPoolStubServer(t)
+	c := newPoolClient(srv.URL, time.Second, time.Minute)
+
+	for i := 0; i < 2*poolBreakerThreshold; i++ {
+		if _, err := c.AccountInfo(stubUnknownAccount); !errors.Is(err, ErrPoolNotFound) {
+			t.Fatalf("AccountInfo %d: got error %v, want %v", i, err, ErrPoolNotFound)
+		}
+	}
+	if n := s.requestCount(); n != 2*poolBreakerThreshold {
+		t.Errorf("got %d requests, want %d", n, 2*poolBreakerThreshold)
+	}
+}
+
+func TestPoolClientAccountEscaped(t *testing.T) {
+	s, srv := newPoolStubServer(t)
+	c := newPoolClient(srv.URL, time.Second, time.Minute)
+
+	c.AccountInfo("a/b?c")
+	if p := s.requestPath(); p != "/json/address/a%2Fb%3Fc" {
+		t.Errorf("got request path %s, want /json/address/a%%2Fb%%3Fc", p)
+	}
+}
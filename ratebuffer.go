@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// one sample per minute for 31 days, covers the daily history in any time zone
+const rateBufferSize = 31 * 24 * 60
+
+const rateBufferSaveInterval = 10 * 60 * time.Second
+
+// ring buffer of staking rate samples, replaces table stakingratestats if no database is configured
+var g_rateBuffer = make([]rateSample, 0, rateBufferSize)
+var g_rateBufferStart int
+var g_rateBufferMutex sync.Mutex
+
+func rateBufferAdd(t int64, rate float64) {
+	g_rateBufferMutex.Lock()
+	defer g_rateBufferMutex.Unlock()
+
+	if len(g_rateBuffer) < rateBufferSize {
+		g_rateBuffer = append(g_rateBuffer, rateSample{t, rate})
+	} else {
+		g_rateBuffer[g_rateBufferStart] = rateSample{t, rate}
+		g_rateBufferStart = (g_rateBufferStart + 1) % rateBufferSize
+	}
+}
+
+// samples not older than <from> in ascending time order
+func rateBufferSamples(from int64) []rateSample {
+	g_rateBufferMutex.Lock()
+	defer g_rateBufferMutex.Unlock()
+
+	n := len(g_rateBuffer)
+	res := make([]rateSample, 0, n)
+
+	for i := 0; i < n; i++ {
+		s := g_rateBuffer[(g_rateBufferStart+i)%n]
+		if s.Time >= from {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// staking rate history bucketed by hours or days of time zone <loc>, in descending time order
+func rateBufferHistory(loc *time.Location, daily bool, cnt int) []StakingRateHistory {
+	return bucketStakingRates(rateBufferSamples(stakingRateHistoryStart(loc, daily, cnt).Unix()), loc, daily, cnt)
+}
+
+// average staking rate of the last <days> days, 0 if there are no samples
+func rateBufferRolling(days int) float64 {
+	samples := rateBufferSamples(time.Now().Unix() - int64(days)*SecondsPerDay)
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, s := range samples {
+		sum += s.Rate
+	}
+
+	return roundRate(sum / float64(len(samples)))
+}
+
+// writes the ring buffer to the configured snapshot file
+func rateBufferSave() {
+	if g_config.RateHistoryFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(rateBufferSamples(0))
+	if err != nil {
+		fmt.Printf("rateBufferSave: Marshal: %v\n", err)
+		return
+	}
+
+	tmpFile := g_config.RateHistoryFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		fmt.Printf("rateBufferSave: write failed: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmpFile, g_config.RateHistoryFile); err != nil {
+		fmt.Printf("rateBufferSave: rename failed: %v\n", err)
+	}
+}
+
+// restores the ring buffer from the configured snapshot file
+func rateBufferLoad() {
+	if g_config.RateHistoryFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(g_config.RateHistoryFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("rateBufferLoad: read failed: %v\n", err)
+		}
+		return
+	}
+
+	var samples []rateSample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		fmt.Printf("rateBufferLoad: syntax error in %s: %v\n", g_config.RateHistoryFile, err)
+		return
+	}
+
+	if len(samples) > rateBufferSize {
+		samples = samples[len(samples)-rateBufferSize:]
+	}
+
+	g_rateBufferMutex.Lock()
+	g_rateBuffer = append(g_rateBuffer[:0], samples...)
+	g_rateBufferStart = 0
+	g_rateBufferMutex.Unlock()
+
+	fmt.Printf("Loaded %d staking rate samples from %s.\n", len(samples), g_config.RateHistoryFile)
+}
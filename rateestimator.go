@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// methods estimating the actual staking rate from a series of rate samples
+const rateMethodEma = "ema"
+const rateMethodMean = "mean"
+const rateMethodTimeWeighted = "timeweighted"
+
+// default window of 200 minutes corresponds to about 100 blocks
+const rateEstimatorDefaultWindow = 200 * 60
+
+type rateSample struct {
+	Time int64   `json:"t"`
+	Rate float64 `json:"r"`
+}
+
+// estimates the actual staking rate from rate samples: per block samples of table stakingratestats if a database
+// is configured, otherwise one sample per status update. The window is given in seconds, so that the estimate
+// does not depend on the sample rate:
+//   - ema: exponential moving average with time constant <window>
+//   - mean: mean of the samples of the last <window> seconds
+//   - timeweighted: mean of the samples of the last <window> seconds, each weighted by the time since the
+//     previous sample
+type rateEstimator struct {
+	Method  string
+	Window  int64
+	samples []rateSample
+	ema     float64
+}
+
+func newRateEstimator(method string, window int64) *rateEstimator {
+	if window <= 0 {
+		window = rateEstimatorDefaultWindow
+	}
+
+	switch method {
+	case rateMethodEma, rateMethodMean, rateMethodTimeWeighted:
+	case "":
+		method = rateMethodMean
+	default:
+		fmt.Printf("Unknown rate estimation method \"%s\", using \"%s\".\n", method, rateMethodMean)
+		method = rateMethodMean
+	}
+
+	return &rateEstimator{Method: method, Window: window}
+}
+
+func newRateEstimatorFromConfig() *rateEstimator {
+	return newRateEstimator(g_config.RateEstimator, int64(g_config.RateEstimatorWindow))
+}
+
+// length of the history in seconds required to initialize the estimator
+func (e *rateEstimator) historyLength() int64 {
+	if e.Method == rateMethodEma {
+		// weight of older samples is below 1%
+		return 5 * e.Window
+	}
+	return e.Window
+}
+
+// adds a sample, samples must be added in ascending time order
+func (e *rateEstimator) Add(t int64, rate float64) {
+	if len(e.samples) == 0 {
+		e.ema = rate
+	} else {
+		dt := t - e.samples[len(e.samples)-1].Time
+		if dt < 0 {
+			dt = 0
+		}
+		e.ema += (1 - math.Exp(-float64(dt)/float64(e.Window))) * (rate - e.ema)
+	}
+
+	e.samples = append(e.samples, rateSample{t, rate})
+
+	i := 0
+	for i < len(e.samples)-1 && e.samples[i].Time < t-e.Window {
+		i++
+	}
+	e.samples = e.samples[i:]
+}
+
+// estimated rate, 0 if no samples were added
+func (e *rateEstimator) Rate() float64 {
+	n := len(e.samples)
+	if n == 0 {
+		return 0
+	}
+
+	switch e.Method {
+	case rateMethodEma:
+		return e.ema
+
+	case rateMethodTimeWeighted:
+		if n > 1 {
+			sum := 0.0
+			weights := 0.0
+			for i := 1; i < n; i++ {
+				w := float64(e.samples[i].Time - e.samples[i-1].Time)
+				sum += w * e.samples[i].Rate
+				weights += w
+			}
+			if weights > 0 {
+				return sum / weights
+			}
+		}
+	}
+
+	sum := 0.0
+	for _, s := range e.samples {
+		sum += s.Rate
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+func roundRate(x float64) float64 {
+	return math.Floor(x*100+0.5) / 100
+}
+
+// start of the oldest of <cnt> hour or day buckets of time zone <loc> ending with the current one
+func stakingRateHistoryStart(loc *time.Location, daily bool, cnt int) time.Time {
+	now := time.Now().In(loc)
+
+	if daily {
+		return time.Date(now.Year(), now.Month(), now.Day()-(cnt-1), 0, 0, 0, 0, loc)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, loc).Add(-time.Duration(cnt-1) * time.Hour)
+}
+
+// staking rate history bucketed by hours or days of time zone <loc>, in descending time order like
+// getStakingRateHistory, which buckets by UTC
+func getStakingRateHistoryTz(loc *time.Location, daily bool, cnt int) ([]StakingRateHistory, error) {
+	rows, err := g_db.Query("SELECT block_time, actual_rate FROM stakingratestats WHERE block_time >= $1 ORDER BY block_time",
+		stakingRateHistoryStart(loc, daily, cnt).Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []rateSample
+
+	for rows.Next() {
+		var s rateSample
+
+		if err := rows.Scan(&s.Time, &s.Rate); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+
+	return bucketStakingRates(samples, loc, daily, cnt), rows.Err()
+}
+
+// buckets <samples> given in ascending time order by hours or days of time zone <loc>, returns the last <cnt>
+// buckets in descending time order
+func bucketStakingRates(samples []rateSample, loc *time.Location, daily bool, cnt int) []StakingRateHistory {
+	res := make([]StakingRateHistory, 0, cnt)
+
+	var bucket int64
+	var rates []float64
+
+	for i := len(samples) - 1; i >= 0 && len(res) < cnt; i-- {
+		t := stakingRateBucketStart(time.Unix(samples[i].Time, 0).In(loc), daily).Unix()
+
+		if len(rates) > 0 && t != bucket {
+			res = append(res, stakingRateStats(bucket, rates))
+			rates = rates[:0]
+		}
+
+		bucket = t
+		rates = append(rates, samples[i].Rate)
+	}
+	if len(rates) > 0 && len(res) < cnt {
+		res = append(res, stakingRateStats(bucket, rates))
+	}
+
+	return res
+}
+
+// statistics of the staking rates of one bucket, <rates> is sorted in place
+func stakingRateStats(timestamp int64, rates []float64) StakingRateHistory {
+	sort.Float64s(rates)
+	n := len(rates)
+
+	sum := 0.0
+	for _, r := range rates {
+		sum += r
+	}
+	avg := sum / float64(n)
+
+	variance := 0.0
+	for _, r := range rates {
+		variance += (r - avg) * (r - avg)
+	}
+	variance /= float64(n)
+
+	return StakingRateHistory{timestamp, roundRate(avg), roundRate(rates[0]), roundRate(rates[n-1]),
+		roundRate(percentile(rates, 0.1)), roundRate(percentile(rates, 0.5)), roundRate(percentile(rates, 0.9)),
+		roundRate(math.Sqrt(variance)), n}
+}
+
+// percentile of sorted values with linear interpolation, same as percentile_cont of Postgres
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	pos := p * float64(len(sorted)-1)
+	i := int(pos)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// average actual staking rate of the last <days> days, 0 if there is no data
+func getStakingRateRolling(days int) float64 {
+	var avg sql.NullFloat64
+
+	err := g_db.QueryRow("SELECT avg(actual_rate) FROM stakingratestats WHERE block_time >= $1",
+		time.Now().Unix()-int64(days)*SecondsPerDay).Scan(&avg)
+	if err != nil {
+		fmt.Printf("getStakingRateRolling: db query failed: %v\n", err)
+		return 0
+	}
+
+	return roundRate(avg.Float64)
+}
+
+// start of the hour or day containing <t> in the time zone of <t>
+func stakingRateBucketStart(t time.Time, daily bool) time.Time {
+	if daily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// parses the tz parameter of history requests, returns nil if not given
+func historyLocation(req *http.Request) (*time.Location, error) {
+	tz := req.URL.Query().Get("tz")
+	if tz == "" {
+		return nil, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// staking rate history for requests with tz parameter, served from the cached UTC history if the time zone does
+// not shift the buckets. The offsets at both ends of the history are checked since the offset of time zones with
+// daylight saving time may change within the history, the history is too short to span two changes.
+func stakingRateHistoryForLocation(loc *time.Location, daily bool) ([]StakingRateHistory, error) {
+	cnt := 24
+	if daily {
+		cnt = 30
+	}
+
+	_, offset := time.Now().In(loc).Zone()
+	_, startOffset := stakingRateHistoryStart(loc, daily, cnt).Zone()
+
+	unshifted := func(o int) bool { return o == 0 || (!daily && o%3600 == 0) }
+	if unshifted(offset) && unshifted(startOffset) {
+		return stakingRateHistoryCopy(daily), nil
+	}
+
+	if g_db == nil {
+		return rateBufferHistory(loc, daily, cnt), nil
+	}
+
+	hist, err := getStakingRateHistoryTz(loc, daily, cnt)
+	if err != nil {
+		fmt.Printf("stakingRateHistoryForLocation: db query failed: %v\n", err)
+		return nil, err
+	}
+
+	return hist, nil
+}
+
+// writes a history response, cached per time zone since bucketing by time zone requires a database query, failed
+// queries are not cached
+func writeStakingRateHistory(resp http.ResponseWriter, req *http.Request, name string,
+	build func(loc *time.Location) (interface{}, error)) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	loc, err := historyLocation(req)
+	if err != nil {
+		writeJsonError(resp, http.StatusBadRequest, "invalid_tz")
+		return
+	}
+
+	key := ""
+	if loc != nil {
+		key = name + "-" + loc.String()
+		if data, ok := rateQueryCacheGet(key); ok {
+			resp.Write(data)
+			return
+		}
+	}
+
+	res, err := build(loc)
+	if err != nil {
+		writeJsonError(resp, http.StatusInternalServerError, "query_failed")
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		fmt.Printf("%s: marshal: %v\n", name, err)
+	}
+
+	if key != "" {
+		rateQueryCachePut(key, data)
+	}
+	resp.Write(data)
+}
+
+// history points as [<label>, <avg rate>, <ISO 8601 time>] in ascending time order, the label is the hour or day of
+// month in time zone <loc>
+func stakingRateHistoryPoints(loc *time.Location, daily bool) ([][]interface{}, error) {
+	var hist []StakingRateHistory
+
+	if loc == nil {
+		loc = time.Local
+		hist = stakingRateHistoryCopy(daily)
+	} else {
+		var err error
+		if hist, err = stakingRateHistoryForLocation(loc, daily); err != nil {
+			return nil, err
+		}
+	}
+
+	data := make([][]interface{}, 0, len(hist))
+
+	for i := len(hist) - 1; i >= 0; i-- {
+		t := time.Unix(hist[i].Timestamp, 0).In(loc)
+
+		label := t.Hour()
+		if daily {
+			label = t.Day()
+		}
+
+		data = append(data, []interface{}{label, hist[i].AvgRate, t.Format(time.RFC3339)})
+	}
+
+	return data, nil
+}
+
+// GET /stakingrate/stats?tz=<time zone>
+func handleStakingRateStats(resp http.ResponseWriter, req *http.Request) {
+	writeStakingRateHistory(resp, req, "handleStakingRateStats", func(loc *time.Location) (interface{}, error) {
+		var histHourly, histDaily []StakingRateHistory
+
+		if loc == nil {
+			histDaily = stakingRateHistoryCopy(true)
+			histHourly = stakingRateHistoryCopy(false)
+		} else {
+			var err error
+			if histDaily, err = stakingRateHistoryForLocation(loc, true); err != nil {
+				return nil, err
+			}
+			if histHourly, err = stakingRateHistoryForLocation(loc, false); err != nil {
+				return nil, err
+			}
+		}
+
+		// ascending time order
+		for i, j := 0, len(histDaily)-1; i < j; i, j = i+1, j-1 {
+			histDaily[i], histDaily[j] = histDaily[j], histDaily[i]
+		}
+		for i, j := 0, len(histHourly)-1; i < j; i, j = i+1, j-1 {
+			histHourly[i], histHourly[j] = histHourly[j], histHourly[i]
+		}
+
+		g_particldStatusMutex.Lock()
+		status := g_particldStatus
+		g_particldStatusMutex.Unlock()
+
+		return struct {
+			Rate7d  float64              `json:"actual_rate_7d"`
+			Rate30d float64              `json:"actual_rate_30d"`
+			Daily   []StakingRateHistory `json:"daily"`
+			Hourly  []StakingRateHistory `json:"hourly"`
+		}{status.ActualRate7d, status.ActualRate30d, histDaily, histHourly}, nil
+	})
+}
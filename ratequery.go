@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const rateQueryMinInterval = 5 * 60
+const rateQueryMaxInterval = 7 * SecondsPerDay
+const rateQueryMaxBuckets = 2000
+const rateQueryCacheTtl = 60 * time.Second
+const rateQueryCacheSize = 100
+
+type rateQueryCacheEntry struct {
+	Data    []byte
+	Expires time.Time
+}
+
+var g_rateQueryCache = make(map[string]rateQueryCacheEntry)
+var g_rateQueryCacheMutex sync.Mutex
+
+// parses an interval given in seconds or with unit suffix m, h, d or w
+func parseInterval(s string) (int64, error) {
+	units := map[byte]int64{'m': 60, 'h': 3600, 'd': SecondsPerDay, 'w': 7 * SecondsPerDay}
+
+	if n := len(s); n > 1 {
+		if u, ok := units[s[n-1]]; ok {
+			v, err := strconv.ParseInt(s[:n-1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			if v > math.MaxInt64/u || v < math.MinInt64/u {
+				return 0, fmt.Errorf("interval %s out of range", s)
+			}
+			return v * u, nil
+		}
+	}
+
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// staking rate statistics of time range [from, to) in buckets of <interval> seconds, in ascending time order
+func queryStakingRates(from, to, interval int64) ([][]interface{}, error) {
+	rows, err := g_db.Query("SELECT block_time/$1 AS x, avg(actual_rate), min(actual_rate), max(actual_rate), count(*) FROM stakingratestats WHERE block_time >= $2 AND block_time < $3 GROUP BY x ORDER BY x",
+		interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	round := func(x float64) float64 { return math.Floor(x*100+0.5) / 100 }
+	res := make([][]interface{}, 0)
+
+	for rows.Next() {
+		var bucket int64
+		var avgRate, minRate, maxRate float64
+		var n int
+
+		if err := rows.Scan(&bucket, &avgRate, &minRate, &maxRate, &n); err != nil {
+			return nil, err
+		}
+		res = append(res, []interface{}{bucket * interval, round(avgRate), round(minRate), round(maxRate), n})
+	}
+
+	return res, rows.Err()
+}
+
+func rateQueryCacheGet(key string) ([]byte, bool) {
+	g_rateQueryCacheMutex.Lock()
+	defer g_rateQueryCacheMutex.Unlock()
+
+	e, ok := g_rateQueryCache[key]
+	if !ok || time.Now().After(e.Expires) {
+		return nil, false
+	}
+	return e.Data, true
+}
+
+func rateQueryCachePut(key string, data []byte) {
+	g_rateQueryCacheMutex.Lock()
+	defer g_rateQueryCacheMutex.Unlock()
+
+	now := time.Now()
+	if len(g_rateQueryCache) >= rateQueryCacheSize {
+		for k, e := range g_rateQueryCache {
+			if now.After(e.Expires) {
+				delete(g_rateQueryCache, k)
+			}
+		}
+	}
+	if len(g_rateQueryCache) >= rateQueryCacheSize {
+		// still full, drop an arbitrary entry
+		for k := range g_rateQueryCache {
+			delete(g_rateQueryCache, k)
+			break
+		}
+	}
+
+	g_rateQueryCache[key] = rateQueryCacheEntry{data, now.Add(rateQueryCacheTtl)}
+}
+
+func writeJsonError(resp http.ResponseWriter, status int, msg string) {
+	resp.WriteHeader(status)
+
+	data, err := json.Marshal(map[string]string{"error": msg})
+	if err != nil {
+		fmt.Printf("writeJsonError: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
+
+// GET /stakingrate/query?from=<unix time>&to=<unix time>&interval=<seconds|5m|1h|1d|1w>
+func handleStakingRateQuery(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+
+	q := req.URL.Query()
+	var err error
+
+	interval := int64(3600)
+	if v := q.Get("interval"); v != "" {
+		if interval, err = parseInterval(v); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_interval")
+			return
+		}
+	}
+	if interval < rateQueryMinInterval || interval > rateQueryMaxInterval {
+		writeJsonError(resp, http.StatusBadRequest, "invalid_interval")
+		return
+	}
+
+	to := time.Now().Unix()
+	if v := q.Get("to"); v != "" {
+		if to, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_to")
+			return
+		}
+	}
+
+	from := to - SecondsPerDay
+	if v := q.Get("from"); v != "" {
+		if from, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeJsonError(resp, http.StatusBadRequest, "invalid_from")
+			return
+		}
+	}
+
+	// align range to bucket boundaries, so that partial buckets are complete and responses can be cached
+	from -= from % interval
+	if to%interval != 0 {
+		to += interval - to%interval
+	}
+
+	if from < 0 || from >= to {
+		writeJsonError(resp, http.StatusBadRequest, "invalid_range")
+		return
+	}
+	if (to-from)/interval > rateQueryMaxBuckets {
+		writeJsonError(resp, http.StatusBadRequest, "too_many_buckets")
+		return
+	}
+
+	if g_db == nil {
+		writeJsonError(resp, http.StatusServiceUnavailable, "no_database")
+		return
+	}
+
+	key := fmt.Sprintf("%d-%d-%d", from, to, interval)
+	if data, ok := rateQueryCacheGet(key); ok {
+		resp.Write(data)
+		return
+	}
+
+	rates, err := queryStakingRates(from, to, interval)
+	if err != nil {
+		fmt.Printf("handleStakingRateQuery: db query failed: %v\n", err)
+		writeJsonError(resp, http.StatusInternalServerError, "query_failed")
+		return
+	}
+
+	res := struct {
+		From     int64           `json:"from"`
+		To       int64           `json:"to"`
+		Interval int64           `json:"interval"`
+		Data     [][]interface{} `json:"data"`
+	}{from, to, interval, rates}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		fmt.Printf("handleStakingRateQuery: marshal: %v\n", err)
+	}
+
+	rateQueryCachePut(key, data)
+	resp.Write(data)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+	_ "time/tzdata"
+)
+
+type TGSchedule struct {
+	Cron     string
+	ChatName string
+	Report   string
+	Timezone string
+}
+
+type tgScheduleJob struct {
+	Config  TGSchedule
+	Key     string
+	Cron    *cronSchedule
+	ChatId  int64
+	LastRun time.Time
+	NextRun time.Time
+	RetryAt time.Time
+}
+
+// interval in which a failed report is retried until it is sent
+const tgScheduleRetryInterval = time.Minute
+
+// reports which can be sent by scheduled messages
+var g_tgReports = map[string]func(chatId int64) bool{
+	"status":        telegramCmdStatus,
+	"stakingrates":  telegramReportStakingRates,
+	"weeklysummary": telegramReportWeeklySummary,
+	"weeklydigest":  telegramReportWeeklyDigest,
+	"monthlydigest": telegramReportMonthlyDigest,
+}
+
+func telegramReportStakingRates(chatId int64) bool {
+	return telegramSendMessage(chatId, telegramStakeInfoMsg(telegramChatLanguage(chatId), 0))
+}
+
+// summary of the last 7 days: daily actual staking rates and current pool staking weight
+func telegramReportWeeklySummary(chatId int64) bool {
+	lang := telegramChatLanguage(chatId)
+
+	g_particldStatusMutex.Lock()
+	status := g_particldStatus
+	g_particldStatusMutex.Unlock()
+
+	hist := stakingRateHistoryCopy(true)
+	if len(hist) > 7 {
+		hist = hist[:7]
+	}
+
+	percent := func(v float64) string { return formatNumber(lang, v, 2) + " %" }
+
+	rows := [][2]string{
+		{tr(lang, "lbl_status"), telegramStatusText(lang, status.Status)},
+		{tr(lang, "lbl_staking"), status.Weight},
+		{tr(lang, "lbl_net_staking"), status.NetWeight},
+		{tr(lang, "lbl_nominal"), percent(status.NominalRate)},
+		{tr(lang, "lbl_actual"), percent(status.ActualRate)},
+	}
+
+	if len(hist) > 0 {
+		avg := 0.0
+		minRate := math.Inf(1)
+		maxRate := math.Inf(-1)
+		for _, h := range hist {
+			avg += h.AvgRate
+			minRate = math.Min(minRate, h.MinRate)
+			maxRate = math.Max(maxRate, h.MaxRate)
+		}
+		avg /= float64(len(hist))
+
+		rows = append(rows, [2]string{tr(lang, "lbl_7d_avg"), percent(avg)},
+			[2]string{tr(lang, "lbl_7d_min"), percent(minRate)},
+			[2]string{tr(lang, "lbl_7d_max"), percent(maxRate)})
+	}
+
+	msg := newTgMsg().Bold(tr(lang, "weekly_summary")).Text("\n").Pre(infoTable(rows))
+
+	if len(hist) > 0 {
+		msg.Append(stakingRateHistoryTable(lang, hist, true))
+	}
+
+	return telegramSendFormatted(chatId, msg)
+}
+
+// returns configured schedules, the legacy daily status message settings are mapped to a schedule
+func telegramSchedules() []TGSchedule {
+	schedules := g_tgConfig.Schedules
+
+	if g_tgConfig.StatusMsgChatName != "" {
+		if g_tgConfig.StatusMsgHour < 0 || g_tgConfig.StatusMsgHour > 23 {
+			fmt.Printf("TG: invalid status message hour value: %d\n", g_tgConfig.StatusMsgHour)
+		} else if g_tgConfig.StatusMsgMinute < 0 || g_tgConfig.StatusMsgMinute > 59 {
+			fmt.Printf("TG: invalid status message minute value: %d\n", g_tgConfig.StatusMsgMinute)
+		} else {
+			schedules = append(schedules, TGSchedule{
+				Cron:     fmt.Sprintf("%d %d * * *", g_tgConfig.StatusMsgMinute, g_tgConfig.StatusMsgHour),
+				ChatName: g_tgConfig.StatusMsgChatName,
+				Report:   "status",
+				Timezone: "UTC"})
+		}
+	}
+
+	return schedules
+}
+
+func telegramLoadScheduleState() map[string]int64 {
+	state := make(map[string]int64)
+
+	if g_tgConfig.ScheduleStateFile == "" {
+		return state
+	}
+
+	data, err := ioutil.ReadFile(g_tgConfig.ScheduleStateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("TG scheduler: failed to read state file: %v\n", err)
+		}
+		return state
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		fmt.Printf("TG scheduler: syntax error in state file %s: %v\n", g_tgConfig.ScheduleStateFile, err)
+	}
+
+	return state
+}
+
+func telegramSaveScheduleState(jobs []*tgScheduleJob) {
+	if g_tgConfig.ScheduleStateFile == "" {
+		return
+	}
+
+	state := make(map[string]int64)
+	for _, j := range jobs {
+		if !j.LastRun.IsZero() {
+			state[j.Key] = j.LastRun.Unix()
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		fmt.Printf("TG scheduler: Marshal: %v\n", err)
+		return
+	}
+
+	tmpFile := g_tgConfig.ScheduleStateFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		fmt.Printf("TG scheduler: failed to write state file: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmpFile, g_tgConfig.ScheduleStateFile); err != nil {
+		fmt.Printf("TG scheduler: failed to rename state file: %v\n", err)
+	}
+}
+
+// sends the report of job <j>, returns false if the report could not be sent
+func telegramRunScheduleJob(j *tgScheduleJob) bool {
+	if j.ChatId == 0 {
+		ok, chatId := telegramGetChat(j.Config.ChatName)
+		if !ok {
+			fmt.Printf("TG: Failed to retrieve chat id for chat %s.\n", j.Config.ChatName)
+			return false
+		}
+		j.ChatId = chatId
+	}
+
+	fmt.Printf("TG scheduler: sending %s report to chat %s(%d)\n", j.Config.Report, j.Config.ChatName, j.ChatId)
+
+	return g_tgReports[j.Config.Report](j.ChatId)
+}
+
+// sends scheduled reports. Last run times are kept in the schedule state file, runs missed while the server
+// was not running are caught up once after startup. Failed runs are retried until the report is sent.
+func telegramScheduler() {
+	var jobs []*tgScheduleJob
+
+	state := telegramLoadScheduleState()
+	now := time.Now()
+
+	if g_tgConfig.ScheduleStateFile == "" {
+		fmt.Printf("TG scheduler: no ScheduleStateFile configured, missed reports are not caught up after restart\n")
+	}
+
+	for _, s := range telegramSchedules() {
+		if _, ok := g_tgReports[s.Report]; !ok {
+			fmt.Printf("TG scheduler: unknown report type \"%s\"\n", s.Report)
+			continue
+		}
+		if s.ChatName == "" {
+			fmt.Printf("TG scheduler: no chat name set for schedule \"%s\"\n", s.Cron)
+			continue
+		}
+
+		tz := s.Timezone
+		if tz == "" {
+			tz = "UTC"
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			fmt.Printf("TG scheduler: invalid timezone \"%s\": %v\n", tz, err)
+			continue
+		}
+
+		c, err := parseCron(s.Cron, loc)
+		if err != nil {
+			fmt.Printf("TG scheduler: invalid schedule \"%s\": %v\n", s.Cron, err)
+			continue
+		}
+
+		j := &tgScheduleJob{Config: s, Cron: c}
+		j.Key = fmt.Sprintf("%s|%s|%s|%s", s.Cron, s.ChatName, s.Report, tz)
+
+		if t, ok := state[j.Key]; ok {
+			j.LastRun = time.Unix(t, 0)
+			j.NextRun = c.Next(j.LastRun)
+		} else {
+			j.NextRun = c.Next(now)
+		}
+
+		if j.NextRun.IsZero() {
+			fmt.Printf("TG scheduler: schedule \"%s\" never triggers\n", s.Cron)
+			continue
+		}
+
+		fmt.Printf("TG scheduler: sending %s report to chat %s, next at %s\n", s.Report, s.ChatName,
+			j.NextRun.Format(time.RFC3339))
+
+		jobs = append(jobs, j)
+	}
+
+	if len(jobs) == 0 {
+		return
+	}
+
+	for {
+		now := time.Now()
+		wait := time.Minute
+
+		for _, j := range jobs {
+			if j.NextRun.IsZero() {
+				continue
+			}
+
+			if !j.NextRun.After(now) && !j.RetryAt.After(now) {
+				if now.Sub(j.NextRun) > time.Minute && j.RetryAt.IsZero() {
+					fmt.Printf("TG scheduler: catching up %s report missed at %s\n", j.Config.Report,
+						j.NextRun.Format(time.RFC3339))
+				}
+
+				if telegramRunScheduleJob(j) {
+					// skip all further missed runs
+					j.LastRun = j.NextRun
+					for next := j.Cron.Next(j.LastRun); !next.IsZero() && !next.After(now); next = j.Cron.Next(next) {
+						j.LastRun = next
+					}
+					j.NextRun = j.Cron.Next(j.LastRun)
+					j.RetryAt = time.Time{}
+					telegramSaveScheduleState(jobs)
+				} else {
+					j.RetryAt = now.Add(tgScheduleRetryInterval)
+					fmt.Printf("TG scheduler: %s report for chat %s failed, retry at %s\n", j.Config.Report,
+						j.Config.ChatName, j.RetryAt.Format(time.RFC3339))
+				}
+			}
+
+			if !j.NextRun.IsZero() {
+				due := j.NextRun
+				if j.RetryAt.After(due) {
+					due = j.RetryAt
+				}
+				if d := time.Until(due); d < wait {
+					wait = d
+				}
+			}
+		}
+
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrPoolNotFound = errors.New("account not found")
+var ErrPoolInvalidAddress = errors.New("invalid address")
+var ErrPoolDown = errors.New("stake pool server not available")
+var ErrPoolTimeout = errors.New("stake pool server timed out")
+var ErrPoolBadResponse = errors.New("bad response from stake pool server")
+
+const poolClientDefaultTimeout = 10
+const poolClientDefaultCacheTtl = 60
+
+// circuit breaker: after poolBreakerThreshold consecutive failures requests are rejected for poolBreakerCooldown,
+// afterwards a single request is let through to probe the server
+const poolBreakerThreshold = 5
+const poolBreakerCooldown = 60 * time.Second
+
+type poolCacheEntry struct {
+	Info    PoolAccountInfo
+	Expires time.Time
+}
+
+type poolClient struct {
+	baseUrl  string
+	client   *http.Client
+	cacheTtl time.Duration
+
+	mutex     sync.Mutex
+	cache     map[string]poolCacheEntry
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var g_poolClient *poolClient
+
+func newPoolClient(baseUrl string, timeout, cacheTtl time.Duration) *poolClient {
+	return &poolClient{baseUrl: strings.TrimRight(baseUrl, "/"), client: &http.Client{Timeout: timeout},
+		cacheTtl: cacheTtl, cache: make(map[string]poolCacheEntry)}
+}
+
+func poolClientInit() {
+	timeout := g_config.StakePoolTimeout
+	if timeout <= 0 {
+		timeout = poolClientDefaultTimeout
+	}
+	ttl := g_config.StakePoolCacheTtl
+	if ttl <= 0 {
+		ttl = poolClientDefaultCacheTtl
+	}
+
+	g_poolClient = newPoolClient(g_config.StakePoolUrl, time.Duration(timeout)*time.Second,
+		time.Duration(ttl)*time.Second)
+}
+
+// checks the circuit breaker, returns false if the request must be rejected
+func (c *poolClient) allow() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.failures < poolBreakerThreshold {
+		return true
+	}
+	if time.Now().Before(c.openUntil) || c.probing {
+		return false
+	}
+
+	c.probing = true
+	return true
+}
+
+func (c *poolClient) record(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.probing = false
+
+	if err == nil || !(errors.Is(err, ErrPoolDown) || errors.Is(err, ErrPoolTimeout)) {
+		if c.failures >= poolBreakerThreshold {
+			fmt.Printf("poolClient: stake pool server available again\n")
+		}
+		c.failures = 0
+		return
+	}
+
+	c.failures++
+	if c.failures >= poolBreakerThreshold {
+		if c.failures == poolBreakerThreshold {
+			fmt.Printf("poolClient: %d consecutive failures, suspending requests\n", c.failures)
+		}
+		c.openUntil = time.Now().Add(poolBreakerCooldown)
+	}
+}
+
+// retrieves <baseUrl>/<cmd> and decodes the JSON response into <res>
+func (c *poolClient) get(cmd string, res interface{}) error {
+	if c.baseUrl == "" {
+		return fmt.Errorf("%w: no stake pool URL configured", ErrPoolDown)
+	}
+
+	if !c.allow() {
+		return fmt.Errorf("%w: requests suspended after repeated failures", ErrPoolDown)
+	}
+
+	err := c.request(cmd, res)
+	c.record(err)
+
+	if err != nil {
+		fmt.Printf("poolClient: %s: %v\n", cmd, err)
+	}
+
+	return err
+}
+
+func (c *poolClient) request(cmd string, res interface{}) error {
+	resp, err := c.client.Get(c.baseUrl + "/" + cmd)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("%w: %v", ErrPoolTimeout, err)
+		}
+		return fmt.Errorf("%w: %v", ErrPoolDown, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return fmt.Errorf("%w: %v", ErrPoolTimeout, err)
+		}
+		return fmt.Errorf("%w: %v", ErrPoolDown, err)
+	}
+
+	// the pool reports address errors in the error field of the response
+	var status struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(body, &status)
+
+	e := strings.ToLower(status.Error)
+	switch {
+	case strings.Contains(e, "invalid address"):
+		return ErrPoolInvalidAddress
+	case resp.StatusCode == http.StatusNotFound || strings.Contains(e, "unknown") || strings.Contains(e, "not found"):
+		return ErrPoolNotFound
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("%w: response status %s", ErrPoolDown, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%w: response status %s", ErrPoolBadResponse, resp.Status)
+	case status.Error != "":
+		return fmt.Errorf("%w: %s", ErrPoolBadResponse, status.Error)
+	}
+
+	if err := json.Unmarshal(body, res); err != nil {
+		return fmt.Errorf("%w: %v", ErrPoolBadResponse, err)
+	}
+
+	return nil
+}
+
+// account info of the pool, successful responses are cached per account
+func (c *poolClient) AccountInfo(account string) (PoolAccountInfo, error) {
+	c.mutex.Lock()
+	e, ok := c.cache[account]
+	c.mutex.Unlock()
+
+	if ok && time.Now().Before(e.Expires) {
+		return e.Info, nil
+	}
+
+	var info PoolAccountInfo
+	if err := c.get("json/address/"+url.PathEscape(account), &info); err != nil {
+		return info, err
+	}
+
+	c.mutex.Lock()
+	now := time.Now()
+	for a, e := range c.cache {
+		if now.After(e.Expires) {
+			delete(c.cache, a)
+		}
+	}
+	c.cache[account] = poolCacheEntry{info, now.Add(c.cacheTtl)}
+	c.mutex.Unlock()
+
+	return info, nil
+}
+
+func (c *poolClient) Summary() (PoolSummary, error) {
+	var res PoolSummary
+	err := c.get("json", &res)
+	return res, err
+}
+
+// message catalog key describing a pool client error
+func poolErrorKey(err error) string {
+	switch {
+	case errors.Is(err, ErrPoolInvalidAddress):
+		return "account_invalid"
+	case errors.Is(err, ErrPoolNotFound):
+		return "account_not_found"
+	case errors.Is(err, ErrPoolTimeout):
+		return "pool_timeout"
+	case errors.Is(err, ErrPoolDown):
+		return "pool_down"
+	}
+	return "account_error"
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type tgPermission int
+
+const (
+	tgPermPublic tgPermission = iota
+	tgPermAdmin
+)
+
+// Args and Description are message catalog keys, Args may also be a literal argument description
+type tgCommand struct {
+	Name        string
+	Args        string
+	Description string
+	Permission  tgPermission
+	Handler     func(chatId int64, from TGUser, args []string)
+}
+
+type TGBotCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+type TGSetMyCommands struct {
+	Commands      []TGBotCommand `json:"commands"`
+	Language_code string         `json:"language_code,omitempty"`
+}
+
+var g_tgCommands map[string]*tgCommand
+
+func telegramRegisterCommand(cmd *tgCommand) {
+	if g_tgCommands == nil {
+		g_tgCommands = make(map[string]*tgCommand)
+	}
+	g_tgCommands[cmd.Name] = cmd
+}
+
+// sets up the bot command registry, must be called before the bot is started
+func telegramInitCommands() {
+	telegramRegisterCommand(&tgCommand{
+		Name:        "start",
+		Description: "cmd_start",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdStart(chatId, from) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "help",
+		Description: "cmd_help",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdHelp(chatId, from) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "status",
+		Description: "cmd_status",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdStatus(chatId) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "accountinfo",
+		Args:        "arg_account",
+		Description: "cmd_accountinfo",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdAccountInfo(chatId, args) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "stakeinfo",
+		Args:        "arg_amount",
+		Description: "cmd_stakeinfo",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdStakeInfo(chatId, args) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "history",
+		Args:        "[hourly|daily|network|weight]",
+		Description: "cmd_history",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdHistory(chatId, args) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "poolinfo",
+		Description: "cmd_poolinfo",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdPoolInfo(chatId) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "blocks",
+		Description: "cmd_blocks",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdBlocks(chatId) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "calc",
+		Args:        "arg_calc",
+		Description: "cmd_calc",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdCalc(chatId, args) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "language",
+		Args:        "[" + strings.Join(languageList(), "|") + "]",
+		Description: "cmd_language",
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdLanguage(chatId, args) },
+	})
+
+	telegramRegisterCommand(&tgCommand{
+		Name:        "stakingoff",
+		Description: "cmd_stakingoff",
+		Permission:  tgPermAdmin,
+		Handler:     func(chatId int64, from TGUser, args []string) { telegramCmdStakingOffPrompt(chatId) },
+	})
+}
+
+// returns registered commands sorted by name, admin commands are included only if <admin> is set
+func telegramCommandList(admin bool) []*tgCommand {
+	var res []*tgCommand
+
+	for _, c := range g_tgCommands {
+		if c.Permission == tgPermAdmin && !admin {
+			continue
+		}
+		res = append(res, c)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res
+}
+
+func telegramIsAdmin(user TGUser) bool {
+	for _, id := range g_tgConfig.AdminUserIds {
+		if id == user.Id {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *tgCommand) args(lang string) string {
+	if _, ok := g_messages[defaultLanguage][c.Args]; ok {
+		return tr(lang, c.Args)
+	}
+	return c.Args
+}
+
+func telegramHelpText(lang string, admin bool) *tgMsg {
+	msg := newTgMsg().Bold(tr(lang, "commands")).Text("\n")
+
+	for _, c := range telegramCommandList(admin) {
+		line := "/" + c.Name
+		if c.Args != "" {
+			line += " " + c.args(lang)
+		}
+		line += " - " + tr(lang, c.Description)
+		if c.Permission == tgPermAdmin {
+			line += " (" + tr(lang, "admin") + ")"
+		}
+		msg.Text(line + "\n")
+	}
+
+	return msg
+}
+
+// dispatches a bot command, <cmd> is passed without leading '/'
+func telegramDispatchCommand(chatId int64, from TGUser, cmd string, args []string) {
+	c, ok := g_tgCommands[cmd]
+
+	if !ok {
+		telegramSendMessage(chatId, tr(telegramChatLanguage(chatId), "invalid_command"))
+		return
+	}
+
+	if c.Permission == tgPermAdmin && !telegramIsAdmin(from) {
+		fmt.Printf("TG: user %s(%d) not permitted to execute command %s\n", from.Username, from.Id, cmd)
+		telegramSendMessage(chatId, tr(telegramChatLanguage(chatId), "permission_denied"))
+		return
+	}
+
+	c.Handler(chatId, from, args)
+}
+
+// publishes list of public commands to Telegram, for each supported language
+func telegramSetMyCommands() bool {
+	ok := true
+
+	for _, lang := range languageList() {
+		var req TGSetMyCommands
+
+		if lang != defaultLanguage {
+			req.Language_code = lang
+		}
+
+		for _, c := range telegramCommandList(false) {
+			desc := tr(lang, c.Description)
+			if c.Args != "" {
+				desc = c.args(lang) + " - " + desc
+			}
+			req.Commands = append(req.Commands, TGBotCommand{c.Name, desc})
+		}
+
+		var res bool
+		if !telegramCall(req, &res, "setMyCommands", 10*time.Second) {
+			fmt.Printf("TG: setMyCommands failed for language %s.\n", lang)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func telegramCmdHelp(chatId int64, from TGUser) bool {
+	return telegramSendFormatted(chatId, telegramHelpText(telegramChatLanguage(chatId), telegramIsAdmin(from)))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type TGInlineKeyboardButton struct {
+	Text          string `json:"text"`
+	Callback_data string `json:"callback_data"`
+}
+
+type TGInlineKeyboardMarkup struct {
+	Inline_keyboard [][]TGInlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type TGEditMessageText struct {
+	Chat_id                  int64                   `json:"chat_id"`
+	Message_id               int                     `json:"message_id"`
+	Text                     string                  `json:"text"`
+	Parse_mode               string                  `json:"parse_mode,omitempty"`
+	Disable_web_page_preview bool                    `json:"disable_web_page_preview"`
+	Reply_markup             *TGInlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type TGAnswerCallbackQuery struct {
+	Callback_query_id string `json:"callback_query_id"`
+	Text              string `json:"text,omitempty"`
+	Show_alert        bool   `json:"show_alert"`
+}
+
+type tgCallback struct {
+	Permission tgPermission
+	Handler    func(q TGCallbackQuery, arg string)
+}
+
+var g_tgCallbacks = map[string]*tgCallback{
+	"status":     {tgPermPublic, telegramCbStatus},
+	"rates":      {tgPermPublic, telegramCbRates},
+	"history":    {tgPermPublic, telegramCbHistory},
+	"stakingoff": {tgPermAdmin, telegramCbStakingOff},
+}
+
+func tgKeyboard(rows ...[]TGInlineKeyboardButton) *TGInlineKeyboardMarkup {
+	return &TGInlineKeyboardMarkup{rows}
+}
+
+func tgButton(text, data string) TGInlineKeyboardButton {
+	return TGInlineKeyboardButton{text, data}
+}
+
+func tgRow(buttons ...TGInlineKeyboardButton) []TGInlineKeyboardButton {
+	return buttons
+}
+
+func telegramStatusKeyboard(lang string) *TGInlineKeyboardMarkup {
+	return tgKeyboard(tgRow(tgButton(tr(lang, "btn_refresh"), "status"), tgButton(tr(lang, "btn_rates"), "rates"),
+		tgButton(tr(lang, "btn_history"), "history:daily")))
+}
+
+func telegramBackKeyboard(lang string) *TGInlineKeyboardMarkup {
+	return tgKeyboard(tgRow(tgButton(tr(lang, "btn_back"), "status")))
+}
+
+func telegramHistoryKeyboard(lang string) *TGInlineKeyboardMarkup {
+	return tgKeyboard(tgRow(tgButton(tr(lang, "btn_hourly"), "history:hourly"),
+		tgButton(tr(lang, "btn_daily"), "history:daily"), tgButton(tr(lang, "btn_back"), "status")))
+}
+
+// replaces text and keyboard of an existing message, messages exceeding the length limit are truncated
+func telegramEditMessage(chatId int64, messageId int, msg *tgMsg, keyboard *TGInlineKeyboardMarkup) bool {
+	mode := telegramParseMode()
+
+	parts := msg.Split(mode, tgMaxMessageLength)
+	if len(parts) == 0 {
+		return false
+	}
+	m := parts[0]
+
+	request := func(text, parseMode string) json.RawMessage {
+		data, err := json.Marshal(TGEditMessageText{chatId, messageId, text, parseMode, false, keyboard})
+		if err != nil {
+			fmt.Printf("telegramEditMessage: Marshal: %v\n", err)
+		}
+		return data
+	}
+
+	item := &tgOutMsg{ChatId: chatId, Method: "editMessageText", Request: request(m.Render(mode), mode),
+		Fallback: request(m.Plain(), "")}
+
+	return telegramWaitAll([]chan bool{telegramEnqueue(item)})
+}
+
+func telegramAnswerCallback(queryId, text string, alert bool) bool {
+	var res bool
+	return telegramCall(TGAnswerCallbackQuery{queryId, text, alert}, &res, "answerCallbackQuery", 10*time.Second)
+}
+
+// dispatches a callback query of an inline keyboard button, callback data has format <name>[:<arg>]
+func telegramDispatchCallback(q TGCallbackQuery) {
+	name, arg := q.Data, ""
+	if n := strings.Index(q.Data, ":"); n >= 0 {
+		name, arg = q.Data[:n], q.Data[n+1:]
+	}
+
+	fmt.Printf("TG callback: %s, arg: %s\n", name, arg)
+
+	lang := telegramChatLanguage(q.Message.Chat.Id)
+
+	cb, ok := g_tgCallbacks[name]
+	if !ok || q.Message.Message_id == 0 {
+		telegramAnswerCallback(q.Id, tr(lang, "invalid_request"), false)
+		return
+	}
+
+	if cb.Permission == tgPermAdmin && !telegramIsAdmin(q.From) {
+		fmt.Printf("TG: user %s(%d) not permitted to execute callback %s\n", q.From.Username, q.From.Id, name)
+		telegramAnswerCallback(q.Id, tr(lang, "permission_denied"), true)
+		return
+	}
+
+	telegramAnswerCallback(q.Id, "", false)
+
+	cb.Handler(q, arg)
+}
+
+func telegramCbStatus(q TGCallbackQuery, arg string) {
+	lang := telegramChatLanguage(q.Message.Chat.Id)
+	telegramEditMessage(q.Message.Chat.Id, q.Message.Message_id, telegramStatusMsg(lang),
+		telegramStatusKeyboard(lang))
+}
+
+func telegramCbRates(q TGCallbackQuery, arg string) {
+	lang := telegramChatLanguage(q.Message.Chat.Id)
+	telegramEditMessage(q.Message.Chat.Id, q.Message.Message_id, newTgMsg().Text(telegramStakeInfoMsg(lang, 0)),
+		telegramBackKeyboard(lang))
+}
+
+func telegramCbHistory(q TGCallbackQuery, arg string) {
+	lang := telegramChatLanguage(q.Message.Chat.Id)
+	daily := arg != "hourly"
+	hist := stakingRateHistoryCopy(daily)
+
+	msg := newTgMsg()
+	if len(hist) == 0 {
+		msg.Text(tr(lang, "no_history"))
+	} else {
+		msg = stakingRateHistoryTable(lang, hist, daily)
+	}
+
+	telegramEditMessage(q.Message.Chat.Id, q.Message.Message_id, msg, telegramHistoryKeyboard(lang))
+}
+
+// asks for confirmation before staking is disabled
+func telegramCmdStakingOffPrompt(chatId int64) {
+	lang := telegramChatLanguage(chatId)
+	kb := tgKeyboard(tgRow(tgButton(tr(lang, "btn_confirm"), "stakingoff:confirm"),
+		tgButton(tr(lang, "btn_cancel"), "stakingoff:cancel")))
+	telegramSendKeyboard(chatId, newTgMsg().Bold(tr(lang, "disable_staking")), kb)
+}
+
+func telegramCbStakingOff(q TGCallbackQuery, arg string) {
+	chatId := q.Message.Chat.Id
+	lang := telegramChatLanguage(chatId)
+	msg := newTgMsg()
+
+	if arg == "confirm" {
+		fmt.Printf("TG: Staking Ctl: off, confirmed by %s(%d)\n", q.From.Username, q.From.Id)
+		msg.Text(tr(lang, "staking_off", stakingCtl(false)))
+	} else {
+		msg.Text(tr(lang, "staking_off", tr(lang, "cancelled")))
+	}
+
+	telegramEditMessage(chatId, q.Message.Message_id, msg, nil)
+}
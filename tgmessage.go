@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf16"
+)
+
+// maximum message length accepted by Telegram
+const tgMaxMessageLength = 4096
+
+// maximum photo caption length accepted by Telegram
+const tgMaxCaptionLength = 1024
+
+const tgParseModeMarkdownV2 = "MarkdownV2"
+const tgParseModeHTML = "HTML"
+
+type tgMsgPartKind int
+
+const (
+	tgPartText tgMsgPartKind = iota
+	tgPartBold
+	tgPartItalic
+	tgPartCode
+	tgPartPre
+	tgPartLink
+)
+
+type tgMsgPart struct {
+	Kind tgMsgPartKind
+	Text string
+	Url  string
+}
+
+// tgMsg is a Telegram message built from parts. All text passed to the builder methods is raw text,
+// escaping is done when the message is rendered for a specific parse mode.
+type tgMsg struct {
+	parts []tgMsgPart
+}
+
+func newTgMsg() *tgMsg {
+	return &tgMsg{}
+}
+
+func (m *tgMsg) add(kind tgMsgPartKind, text, url string) *tgMsg {
+	if text != "" {
+		m.parts = append(m.parts, tgMsgPart{kind, text, url})
+	}
+	return m
+}
+
+func (m *tgMsg) Text(format string, a ...interface{}) *tgMsg {
+	if len(a) > 0 {
+		format = fmt.Sprintf(format, a...)
+	}
+	return m.add(tgPartText, format, "")
+}
+
+func (m *tgMsg) Bold(s string) *tgMsg {
+	return m.add(tgPartBold, s, "")
+}
+
+func (m *tgMsg) Italic(s string) *tgMsg {
+	return m.add(tgPartItalic, s, "")
+}
+
+func (m *tgMsg) Code(s string) *tgMsg {
+	return m.add(tgPartCode, s, "")
+}
+
+// Pre adds a preformatted (fixed width) block, a trailing newline is appended if missing.
+func (m *tgMsg) Pre(s string) *tgMsg {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return m.add(tgPartPre, s, "")
+}
+
+// TextCode adds text <tpl> in which the first "%s" is replaced by <code> formatted as inline code
+func (m *tgMsg) TextCode(tpl, code string) *tgMsg {
+	n := strings.Index(tpl, "%s")
+	if n < 0 {
+		return m.Text(tpl)
+	}
+	return m.add(tgPartText, tpl[:n], "").Code(code).add(tgPartText, tpl[n+2:], "")
+}
+
+func (m *tgMsg) Link(text, url string) *tgMsg {
+	return m.add(tgPartLink, text, url)
+}
+
+func (m *tgMsg) Append(o *tgMsg) *tgMsg {
+	m.parts = append(m.parts, o.parts...)
+	return m
+}
+
+func (m *tgMsg) Empty() bool {
+	return len(m.parts) == 0
+}
+
+var tgMarkdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+	"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!")
+
+var tgMarkdownV2CodeEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+var tgMarkdownV2UrlEscaper = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+func tgEscapeMarkdownV2(s string) string {
+	return tgMarkdownV2Escaper.Replace(s)
+}
+
+func (p *tgMsgPart) render(mode string) string {
+	switch mode {
+	case tgParseModeMarkdownV2:
+		switch p.Kind {
+		case tgPartBold:
+			return "*" + tgEscapeMarkdownV2(p.Text) + "*"
+		case tgPartItalic:
+			return "_" + tgEscapeMarkdownV2(p.Text) + "_"
+		case tgPartCode:
+			return "`" + tgMarkdownV2CodeEscaper.Replace(p.Text) + "`"
+		case tgPartPre:
+			return "```\n" + tgMarkdownV2CodeEscaper.Replace(p.Text) + "```"
+		case tgPartLink:
+			return "[" + tgEscapeMarkdownV2(p.Text) + "](" + tgMarkdownV2UrlEscaper.Replace(p.Url) + ")"
+		default:
+			return tgEscapeMarkdownV2(p.Text)
+		}
+
+	case tgParseModeHTML:
+		switch p.Kind {
+		case tgPartBold:
+			return "<b>" + html.EscapeString(p.Text) + "</b>"
+		case tgPartItalic:
+			return "<i>" + html.EscapeString(p.Text) + "</i>"
+		case tgPartCode:
+			return "<code>" + html.EscapeString(p.Text) + "</code>"
+		case tgPartPre:
+			return "<pre>" + html.EscapeString(p.Text) + "</pre>"
+		case tgPartLink:
+			return "<a href=\"" + html.EscapeString(p.Url) + "\">" + html.EscapeString(p.Text) + "</a>"
+		default:
+			return html.EscapeString(p.Text)
+		}
+
+	default:
+		if p.Kind == tgPartLink {
+			return p.Text + " (" + p.Url + ")"
+		}
+		return p.Text
+	}
+}
+
+// Render returns the message formatted for given parse mode. An empty mode renders plain text.
+func (m *tgMsg) Render(mode string) string {
+	var sb strings.Builder
+
+	for i := range m.parts {
+		sb.WriteString(m.parts[i].render(mode))
+	}
+
+	return sb.String()
+}
+
+func (m *tgMsg) Plain() string {
+	return m.Render("")
+}
+
+// message length as counted by Telegram (UTF-16 code units)
+func tgLength(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// splits text into pieces for which <fits> returns true, splits at line breaks if possible
+func tgSplitText(text string, fits func(string) bool) []string {
+	var res []string
+
+	for text != "" {
+		if fits(text) {
+			res = append(res, text)
+			break
+		}
+
+		runes := []rune(text)
+
+		// largest prefix that fits
+		lo, hi := 1, len(runes)
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			if fits(string(runes[:mid])) {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+
+		n := lo
+		if i := strings.LastIndex(string(runes[:n]), "\n"); i > 0 {
+			n = len([]rune(string(runes[:n])[:i+1]))
+		}
+
+		res = append(res, string(runes[:n]))
+		text = string(runes[n:])
+	}
+
+	return res
+}
+
+// Split splits the message into messages not exceeding <limit> characters when rendered in given parse mode.
+// Messages are split between parts; a part which is too long by itself is split at line breaks.
+func (m *tgMsg) Split(mode string, limit int) []*tgMsg {
+	var res []*tgMsg
+
+	cur := newTgMsg()
+	curLen := 0
+
+	flush := func() {
+		if !cur.Empty() {
+			res = append(res, cur)
+		}
+		cur = newTgMsg()
+		curLen = 0
+	}
+
+	for _, p := range m.parts {
+		l := tgLength(p.render(mode))
+
+		if curLen+l <= limit {
+			cur.parts = append(cur.parts, p)
+			curLen += l
+			continue
+		}
+
+		flush()
+
+		if l <= limit {
+			cur.parts = append(cur.parts, p)
+			curLen = l
+			continue
+		}
+
+		pieces := tgSplitText(p.Text, func(s string) bool {
+			q := tgMsgPart{p.Kind, s, p.Url}
+			return tgLength(q.render(mode)) <= limit
+		})
+
+		for i, s := range pieces {
+			q := tgMsgPart{p.Kind, s, p.Url}
+			cur.parts = append(cur.parts, q)
+			curLen = tgLength(q.render(mode))
+			if i < len(pieces)-1 {
+				flush()
+			}
+		}
+	}
+
+	flush()
+
+	return res
+}
+
+// configured parse mode for formatted messages
+func telegramParseMode() string {
+	if g_tgConfig.ParseMode == tgParseModeHTML {
+		return tgParseModeHTML
+	}
+	return tgParseModeMarkdownV2
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"sync"
+	"time"
+)
+
+// Telegram limits: about 30 messages per second in total, 1 message per second to the same chat
+// and 20 messages per minute to the same group.
+const tgGlobalSendInterval = time.Second / 30
+const tgChatSendInterval = time.Second
+const tgGroupSendInterval = 3 * time.Second
+
+// number of attempts for non persistent messages before they are dropped
+const tgMaxAttempts = 4
+
+const tgMaxBackoff = 10 * time.Minute
+
+const tgDefaultOutboxMaxEntries = 100
+
+// tgCallError describes a failed bot API request. StatusCode is 0 if the request failed on transport level.
+type tgCallError struct {
+	StatusCode  int
+	Description string
+	RetryAfter  int
+}
+
+// tgOutMsg is an outbound bot API request. Fallback is sent instead of Request if Telegram rejects Request,
+// e.g. because of a formatting error. Persistent messages are stored in the outbox file until delivered.
+type tgOutMsg struct {
+	Id        int64
+	ChatId    int64
+	Method    string
+	Request   json.RawMessage
+	Fallback  json.RawMessage `json:",omitempty"`
+	Photo     []byte          `json:",omitempty"`
+	Persist   bool
+	Created   time.Time
+	Attempts  int
+	NotBefore time.Time
+
+	result chan bool
+}
+
+var g_tgQueue []*tgOutMsg
+var g_tgQueueMutex sync.Mutex
+var g_tgQueueSignal = make(chan struct{}, 1)
+var g_tgQueueNextId int64
+var g_tgChatNextSend = make(map[int64]time.Time)
+
+// adds a message to the outbound queue, the returned channel receives the delivery result
+func telegramEnqueue(item *tgOutMsg) chan bool {
+	item.result = make(chan bool, 1)
+	if item.Created.IsZero() {
+		item.Created = time.Now()
+	}
+
+	g_tgQueueMutex.Lock()
+	g_tgQueueNextId++
+	item.Id = g_tgQueueNextId
+	g_tgQueue = append(g_tgQueue, item)
+	if item.Persist {
+		telegramTrimOutbox()
+		telegramSaveOutbox()
+	}
+	g_tgQueueMutex.Unlock()
+
+	select {
+	case g_tgQueueSignal <- struct{}{}:
+	default:
+	}
+
+	return item.result
+}
+
+// reports the delivery result, only the first result counts: a message may be dropped from a full outbox
+// while it is being sent and is then reported once more by the sender
+func (item *tgOutMsg) done(ok bool) {
+	select {
+	case item.result <- ok:
+	default:
+	}
+}
+
+func telegramWaitAll(results []chan bool) bool {
+	ok := true
+	for _, r := range results {
+		if !<-r {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func telegramOutboxMaxEntries() int {
+	if g_tgConfig.OutboxMaxEntries > 0 {
+		return g_tgConfig.OutboxMaxEntries
+	}
+	return tgDefaultOutboxMaxEntries
+}
+
+// drops oldest persistent messages if outbox limit is exceeded, queue mutex must be held
+func telegramTrimOutbox() {
+	n := 0
+	for _, item := range g_tgQueue {
+		if item.Persist {
+			n++
+		}
+	}
+
+	excess := n - telegramOutboxMaxEntries()
+	if excess <= 0 {
+		return
+	}
+
+	var tmp []*tgOutMsg
+	for _, item := range g_tgQueue {
+		if item.Persist && excess > 0 {
+			excess--
+			fmt.Printf("TG outbox: full, dropping message %d for chat %d\n", item.Id, item.ChatId)
+			item.done(false)
+			continue
+		}
+		tmp = append(tmp, item)
+	}
+	g_tgQueue = tmp
+}
+
+// writes persistent messages to outbox file, queue mutex must be held
+func telegramSaveOutbox() {
+	if g_tgConfig.OutboxFile == "" {
+		return
+	}
+
+	items := make([]*tgOutMsg, 0)
+	for _, item := range g_tgQueue {
+		if item.Persist {
+			items = append(items, item)
+		}
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		fmt.Printf("TG outbox: Marshal: %v\n", err)
+		return
+	}
+
+	tmpFile := g_tgConfig.OutboxFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		fmt.Printf("TG outbox: write failed: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmpFile, g_tgConfig.OutboxFile); err != nil {
+		fmt.Printf("TG outbox: rename failed: %v\n", err)
+	}
+}
+
+// loads undelivered messages from outbox file into the queue
+func telegramLoadOutbox() {
+	if g_tgConfig.OutboxFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(g_tgConfig.OutboxFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("TG outbox: read failed: %v\n", err)
+		}
+		return
+	}
+
+	var items []*tgOutMsg
+	if err := json.Unmarshal(data, &items); err != nil {
+		fmt.Printf("TG outbox: syntax error in %s: %v\n", g_tgConfig.OutboxFile, err)
+		return
+	}
+
+	if len(items) > 0 {
+		fmt.Printf("TG outbox: %d undelivered messages loaded\n", len(items))
+	}
+
+	for _, item := range items {
+		item.Attempts = 0
+		item.NotBefore = time.Time{}
+		telegramEnqueue(item)
+	}
+}
+
+func telegramChatSendInterval(chatId int64) time.Duration {
+	if chatId < 0 {
+		return tgGroupSendInterval
+	}
+	return tgChatSendInterval
+}
+
+// selects next message to be sent: the oldest message of each chat is eligible if its chat's rate limit and
+// backoff time allow sending. Returns nil and the time to wait if no message is eligible.
+func telegramNextOutMsg() (*tgOutMsg, time.Duration) {
+	g_tgQueueMutex.Lock()
+	defer g_tgQueueMutex.Unlock()
+
+	now := time.Now()
+	wait := time.Minute
+	seen := make(map[int64]bool)
+
+	for _, item := range g_tgQueue {
+		if seen[item.ChatId] {
+			continue
+		}
+		seen[item.ChatId] = true
+
+		t := item.NotBefore
+		if next := g_tgChatNextSend[item.ChatId]; next.After(t) {
+			t = next
+		}
+
+		if !t.After(now) {
+			return item, 0
+		}
+
+		if d := t.Sub(now); d < wait {
+			wait = d
+		}
+	}
+
+	return nil, wait
+}
+
+func telegramRemoveOutMsg(item *tgOutMsg, ok bool) {
+	g_tgQueueMutex.Lock()
+	for i, q := range g_tgQueue {
+		if q == item {
+			g_tgQueue = append(g_tgQueue[:i], g_tgQueue[i+1:]...)
+			break
+		}
+	}
+	if item.Persist {
+		telegramSaveOutbox()
+	}
+	g_tgQueueMutex.Unlock()
+
+	item.done(ok)
+}
+
+func telegramSendOutMsg(item *tgOutMsg) *tgCallError {
+	if item.Method != "sendPhoto" {
+		return telegramRequest(item.Method, "application/json", bytes.NewReader(item.Request), nil, 10*time.Second)
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal(item.Request, &fields); err != nil {
+		return &tgCallError{StatusCode: 400, Description: err.Error()}
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	for k, v := range fields {
+		if v != "" {
+			w.WriteField(k, v)
+		}
+	}
+
+	part, err := w.CreateFormFile("photo", "chart.png")
+	if err != nil {
+		return &tgCallError{StatusCode: 400, Description: err.Error()}
+	}
+	part.Write(item.Photo)
+
+	if err := w.Close(); err != nil {
+		return &tgCallError{StatusCode: 400, Description: err.Error()}
+	}
+
+	return telegramRequest("sendPhoto", w.FormDataContentType(), &body, nil, 30*time.Second)
+}
+
+// delivers queued messages respecting rate limits, failed requests are retried with exponential backoff
+func telegramSender() {
+	var lastSend time.Time
+
+	for {
+		item, wait := telegramNextOutMsg()
+
+		if item == nil {
+			select {
+			case <-g_tgQueueSignal:
+			case <-time.After(wait):
+			}
+			continue
+		}
+
+		if d := tgGlobalSendInterval - time.Since(lastSend); d > 0 {
+			time.Sleep(d)
+		}
+		lastSend = time.Now()
+
+		callErr := telegramSendOutMsg(item)
+
+		g_tgQueueMutex.Lock()
+		g_tgChatNextSend[item.ChatId] = time.Now().Add(telegramChatSendInterval(item.ChatId))
+		g_tgQueueMutex.Unlock()
+
+		if callErr == nil {
+			telegramRemoveOutMsg(item, true)
+			continue
+		}
+
+		item.Attempts++
+
+		transient := callErr.StatusCode == 0 || callErr.StatusCode == 429 || callErr.StatusCode >= 500
+
+		if !transient {
+			if item.Fallback != nil {
+				fmt.Printf("TG sender: %s rejected, retrying as plain text\n", item.Method)
+				g_tgQueueMutex.Lock()
+				item.Request = item.Fallback
+				item.Fallback = nil
+				g_tgQueueMutex.Unlock()
+				continue
+			}
+
+			fmt.Printf("TG sender: dropping %s for chat %d: %d %s\n", item.Method, item.ChatId,
+				callErr.StatusCode, callErr.Description)
+			telegramRemoveOutMsg(item, false)
+			continue
+		}
+
+		if !item.Persist && item.Attempts >= tgMaxAttempts {
+			fmt.Printf("TG sender: giving up %s for chat %d after %d attempts\n", item.Method, item.ChatId,
+				item.Attempts)
+			telegramRemoveOutMsg(item, false)
+			continue
+		}
+
+		backoff := time.Second << uint(item.Attempts-1)
+		if backoff > tgMaxBackoff || backoff <= 0 {
+			backoff = tgMaxBackoff
+		}
+		if retryAfter := time.Duration(callErr.RetryAfter) * time.Second; retryAfter > backoff {
+			backoff = retryAfter
+		}
+
+		fmt.Printf("TG sender: %s for chat %d failed, retry in %s\n", item.Method, item.ChatId, backoff)
+
+		g_tgQueueMutex.Lock()
+		item.NotBefore = time.Now().Add(backoff)
+		g_tgQueueMutex.Unlock()
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mua69/particlrpc"
+)
+
+type WalletInfo struct {
+	Walletname       string  `json:"walletname"`
+	Encryptionstatus string  `json:"encryptionstatus"`
+	Unlocked_until   int64   `json:"unlocked_until"`
+	Total_balance    float64 `json:"total_balance"`
+	Balance          float64 `json:"balance"`
+	Staked_balance   float64 `json:"staked_balance"`
+}
+
+type WalletHealth struct {
+	Updated         int64   `json:"updated"`
+	Loaded          bool    `json:"loaded"`
+	Encrypted       bool    `json:"encrypted"`
+	Locked          bool    `json:"locked"`
+	StakingOnly     bool    `json:"unlocked_staking_only"`
+	Balance         float64 `json:"balance"`
+	StakedBalance   float64 `json:"staked_balance"`
+	StakeableWeight float64 `json:"stakeable_weight"`
+	Issue           string  `json:"issue"`
+}
+
+// wallet issues preventing staking
+const walletIssueNotLoaded = "not_loaded"
+const walletIssueLocked = "locked"
+const walletIssueNoWeight = "no_weight"
+
+const walletDefaultWeightDropPercent = 25
+
+var g_walletHealth WalletHealth
+var g_walletHealthMutex sync.Mutex
+
+// checks state and balances of the staking wallet, <stakeinfo> is nil if it could not be retrieved
+func walletCheck(prpc *particlrpc.ParticlRpc, stakeinfo *particlrpc.StakingInfo) (WalletHealth, error) {
+	h := WalletHealth{Updated: time.Now().Unix()}
+
+	var wallets []string
+	if err := prpc.CallRpc("listwallets", "", nil, &wallets); err != nil {
+		return h, err
+	}
+
+	for _, w := range wallets {
+		if w == g_config.ParticldStakingWallet {
+			h.Loaded = true
+		}
+	}
+
+	if !h.Loaded {
+		h.Issue = walletIssueNotLoaded
+		return h, nil
+	}
+
+	var info WalletInfo
+	if err := prpc.CallRpc("getwalletinfo", g_config.ParticldStakingWallet, nil, &info); err != nil {
+		return h, err
+	}
+
+	status := strings.ToLower(info.Encryptionstatus)
+	h.Encrypted = status != "" && status != "unencrypted"
+	h.Locked = status == "locked"
+	h.StakingOnly = strings.Contains(status, "staking only")
+	h.Balance = info.Total_balance
+	h.StakedBalance = info.Staked_balance
+
+	if stakeinfo != nil {
+		h.StakeableWeight = float64(stakeinfo.Weight) / SatPerPart
+	}
+
+	switch {
+	case h.Locked:
+		h.Issue = walletIssueLocked
+	case stakeinfo != nil && stakeinfo.Weight == 0:
+		h.Issue = walletIssueNoWeight
+	}
+
+	return h, nil
+}
+
+func walletHealthSet(h WalletHealth) {
+	g_walletHealthMutex.Lock()
+	g_walletHealth = h
+	g_walletHealthMutex.Unlock()
+}
+
+func walletHealthCopy() WalletHealth {
+	g_walletHealthMutex.Lock()
+	defer g_walletHealthMutex.Unlock()
+	return g_walletHealth
+}
+
+// watchdog message naming the wallet issue, empty if no issue was detected
+func walletIssueText(lang string, h WalletHealth) string {
+	switch h.Issue {
+	case walletIssueNotLoaded:
+		return tr(lang, "wd_wallet_not_loaded", g_config.ParticldStakingWallet)
+	case walletIssueLocked:
+		return tr(lang, "wd_wallet_locked")
+	case walletIssueNoWeight:
+		return tr(lang, "wd_no_weight")
+	}
+	return ""
+}
+
+// checks whether the stakeable weight dropped by more than the configured percentage since the previous check
+func walletWeightDropped(prev, cur float64) bool {
+	pct := g_config.WalletWeightDropPercent
+	if pct <= 0 {
+		pct = walletDefaultWeightDropPercent
+	}
+
+	return prev > 0 && cur < prev*(1-float64(pct)/100)
+}
+
+func handleWalletHealth(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	data, err := json.Marshal(walletHealthCopy())
+	if err != nil {
+		fmt.Printf("handleWalletHealth: marshal: %v\n", err)
+	}
+	io.WriteString(resp, string(data))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const poolWatchdogDefaultMaxLatency = 5
+const poolWatchdogDefaultMaxBlockLag = 10
+
+// number of consecutive checks a pool failure must be observed before it is reported
+const poolWatchdogConfirmChecks = 2
+
+var g_watchdogChatId int64
+var g_watchdogChatIdOk bool
+var g_watchdogChatMutex sync.Mutex
+
+func watchdogEnabled() bool {
+	return (g_TGBotEnabled && g_tgConfig.WatchdogMsgChatName != "") ||
+		(g_config.WatchdogEmailFrom != "" && g_config.WatchdogEmailTo != "")
+}
+
+// chat id of the watchdog chat, retrieved on first use since Telegram may be unreachable at startup
+func watchdogChatId() (int64, bool) {
+	if !g_TGBotEnabled || g_tgConfig.WatchdogMsgChatName == "" {
+		return 0, false
+	}
+
+	g_watchdogChatMutex.Lock()
+	defer g_watchdogChatMutex.Unlock()
+
+	if !g_watchdogChatIdOk {
+		g_watchdogChatIdOk, g_watchdogChatId = telegramGetChat(g_tgConfig.WatchdogMsgChatName)
+
+		if !g_watchdogChatIdOk {
+			fmt.Printf("TG: Failed to retrieve chat id for chat %s.\n", g_tgConfig.WatchdogMsgChatName)
+		}
+	}
+
+	return g_watchdogChatId, g_watchdogChatIdOk
+}
+
+// sends a watchdog message to the watchdog chat and by email
+func watchdogAlert(msg string) {
+	if chatId, ok := watchdogChatId(); ok {
+		telegramSendAlert(chatId, newTgMsg().Text(msg))
+	}
+
+	sendWatchdogEmail(msg, true)
+}
+
+// sends an informational message to the watchdog chat and by email
+func watchdogInfo(msg string) {
+	if chatId, ok := watchdogChatId(); ok {
+		telegramSendAlert(chatId, newTgMsg().Text(msg))
+	}
+
+	sendWatchdogEmail(msg, false)
+}
+
+// checks reachability, response time and block height of the stake pool server
+func poolWatchdogCheck(lang string) (state, msg string) {
+	maxLatency := g_config.PoolWatchdogMaxLatency
+	if maxLatency <= 0 {
+		maxLatency = poolWatchdogDefaultMaxLatency
+	}
+	maxLag := g_config.PoolWatchdogMaxBlockLag
+	if maxLag <= 0 {
+		maxLag = poolWatchdogDefaultMaxBlockLag
+	}
+
+	start := time.Now()
+	summary, err := g_poolClient.Summary()
+	latency := time.Since(start)
+
+	if err != nil {
+		if errors.Is(err, ErrPoolTimeout) {
+			return "timeout", tr(lang, "wd_pool_timeout")
+		}
+		return "down", tr(lang, "wd_pool_down")
+	}
+
+	if latency > time.Duration(maxLatency)*time.Second {
+		return "slow", tr(lang, "wd_pool_slow", formatNumber(lang, latency.Seconds(), 1), maxLatency)
+	}
+
+	g_particldStatusMutex.Lock()
+	lastBlock := g_particldStatus.LastBlock
+	g_particldStatusMutex.Unlock()
+
+	if nodeHeight, err := strconv.ParseInt(lastBlock, 10, 64); err == nil {
+		if lag := nodeHeight - summary.Poolheight; lag > int64(maxLag) {
+			return "behind", tr(lang, "wd_pool_behind", lag, summary.Poolheight, nodeHeight)
+		}
+	}
+
+	return "ok", tr(lang, "wd_normal")
+}
+
+// monitors the stake pool server, alerts are sent when the state changes
+func poolWatchdog() {
+	lang := watchdogLanguage()
+
+	lastState := ""
+	pendingState := ""
+	pendingCount := 0
+
+	for {
+		state, msg := poolWatchdogCheck(lang)
+
+		if state != "ok" && state != lastState {
+			// failures must persist for several checks to suppress alerts on single slow responses
+			if state == pendingState {
+				pendingCount++
+			} else {
+				pendingState = state
+				pendingCount = 1
+			}
+			if pendingCount < poolWatchdogConfirmChecks && lastState != "" {
+				time.Sleep(60 * time.Second)
+				continue
+			}
+		}
+		pendingState = ""
+
+		if state != lastState {
+			lastState = state
+			fmt.Printf("Pool Watchdog: %s\n", msg)
+			watchdogRecordEvent("pool", state == "ok", msg)
+			eventsPublish("watchdog", map[string]interface{}{"source": "pool", "ok": state == "ok", "state": state,
+				"message": msg})
+
+			watchdogAlert(tr(lang, "wd_pool_prefix", msg) + "\n")
+		}
+
+		time.Sleep(60 * time.Second)
+	}
+}